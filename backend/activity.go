@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"gorm.io/gorm"
+)
+
+// deviceIDHeader identifies the client device that made a request
+const deviceIDHeader = "X-Device-ID"
+
+// Activity pages hold 50 entries unless asked otherwise, and at most 200
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 200
+)
+
+type ActivityPage struct {
+	Activities []database.Activity `json:"activities"`
+	Total      int64               `json:"total"`
+	Limit      int                 `json:"limit"`
+	Offset     int                 `json:"offset"`
+}
+
+func listActivities(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing activity").Send()
+
+	query := database.ActivityQuery{
+		EntityType: r.URL.Query().Get("entity_type"),
+		DeviceID:   r.URL.Query().Get("device_id"),
+	}
+	if entityID := r.URL.Query().Get("entity_id"); entityID != "" {
+		id, err := strconv.ParseUint(entityID, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid entity_id", http.StatusBadRequest)
+			return
+		}
+		query.EntityID = uint(id)
+	}
+	writeActivityPage(w, r, query)
+}
+
+func listTaskActivity(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Listing task activity").Uint("task_id", id).Send()
+	writeActivityPage(w, r, database.ActivityQuery{EntityType: database.ActivityEntityTask, EntityID: id})
+}
+
+func listProjectActivity(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseProjectID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Listing project activity").Uint("project_id", id).Send()
+	writeActivityPage(w, r, database.ActivityQuery{EntityType: database.ActivityEntityProject, EntityID: id})
+}
+
+func listNoteActivity(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseNoteID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Listing note activity").Uint("note_id", id).Send()
+	writeActivityPage(w, r, database.ActivityQuery{EntityType: database.ActivityEntityNote, EntityID: id})
+}
+
+// writeActivityPage applies the limit and offset query parameters and writes the page
+func writeActivityPage(w http.ResponseWriter, r *http.Request, query database.ActivityQuery) {
+	limit, err := utils.QueryInt(r, "limit", defaultActivityLimit)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	offset, err := utils.QueryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	query.Limit = min(limit, maxActivityLimit)
+	query.Offset = offset
+
+	activities, total, err := database.ListActivities(database.DB, query)
+	if err != nil {
+		logger.Error("Failed to retrieve activity").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully retrieved activity").Int("count", len(activities)).Int64("total", total).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ActivityPage{
+		Activities: activities,
+		Total:      total,
+		Limit:      query.Limit,
+		Offset:     query.Offset,
+	})
+}
+
+// activityMeta collects the request details stored with each activity entry
+func activityMeta(r *http.Request) database.ActivityMeta {
+	return database.ActivityMeta{
+		DeviceID:   r.Header.Get(deviceIDHeader),
+		RequestID:  chimiddleware.GetReqID(r.Context()),
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+}
+
+// recordActivity writes an audit entry for a change that already succeeded. Failures
+// are logged rather than reported, since the change itself can't be undone.
+func recordActivity(r *http.Request, entityType string, id uint, action string, before, after any) {
+	err := database.RecordActivity(database.DB, activityMeta(r), entityType, id, action, before, after)
+	if err != nil {
+		logger.Warn("Failed to record activity").Str("entity_type", entityType).Uint("entity_id", id).Str("action", action).Err(err).Send()
+	}
+}
+
+// recordUpdate reloads an entity into fresh and records the change from before
+func recordUpdate(r *http.Request, entityType string, id uint, action string, before, fresh any) {
+	if err := database.DB.Where("id = ?", id).First(fresh).Error; err != nil {
+		logger.Warn("Failed to reload entity for activity").Str("entity_type", entityType).Uint("entity_id", id).Err(err).Send()
+		return
+	}
+	recordActivity(r, entityType, id, action, before, fresh)
+}
+
+// recordReorder records the order change of every reordered entity. previous maps IDs
+// to their order before the change; IDs that weren't found or didn't move are skipped.
+func recordReorder(r *http.Request, entityType string, ids []uint, previous map[uint]int) {
+	for i, id := range ids {
+		old, ok := previous[id]
+		if !ok || old == i+1 {
+			continue
+		}
+		recordActivity(r, entityType, id, database.ActivityReorder, map[string]any{"order": old}, map[string]any{"order": i + 1})
+	}
+}
+
+// currentOrders maps the IDs matched by query to their current order
+func currentOrders(query *gorm.DB, ids []uint) (map[uint]int, error) {
+	var rows []struct {
+		ID    uint
+		Order int
+	}
+	if err := query.Select("id", `"order"`).Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	orders := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		orders[row.ID] = row.Order
+	}
+	return orders, nil
+}
+
+// loadEntity fetches the entity with the given ID into dest, writing a 404 or 500
+// response on failure
+func loadEntity(w http.ResponseWriter, dest any, id uint, name string) bool {
+	err := database.DB.Where("id = ?", id).First(dest).Error
+	if err == nil {
+		return true
+	}
+	if err == gorm.ErrRecordNotFound {
+		logger.Error(name+" not found").Uint("id", id).Send()
+		http.Error(w, name+" not found", http.StatusNotFound)
+		return false
+	}
+	logger.Error("Failed to fetch "+strings.ToLower(name)).Uint("id", id).Err(err).Send()
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+	return false
+}
@@ -3,51 +3,88 @@ package ai
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/dima-b/go-task-backend/logger"
-	"github.com/revrost/go-openrouter"
 )
 
+// Tool is a function the model may call. Calls of tools that RequiresConfirmation
+// aren't run by the agent but returned as pending, for the user to approve. ReadOnly
+// tools change nothing, so they still run in dry runs, where every other call is
+// held as pending. Additive tools only add data, so they don't count towards the
+// write limit.
 type Tool struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	Parameters  map[string]interface{} `json:"parameters"`
-	Function    func(args map[string]interface{}) (string, error)
+	Name                 string                 `json:"name"`
+	Description          string                 `json:"description"`
+	Parameters           map[string]interface{} `json:"parameters"`
+	ReadOnly             bool                   `json:"read_only"`
+	Additive             bool                   `json:"additive"`
+	RequiresConfirmation bool                   `json:"requires_confirmation"`
+	Function             func(ctx context.Context, args map[string]interface{}) (string, error)
 }
 
 type Agent struct {
-	client        *openrouter.Client
+	provider      Provider
 	context       string
 	tools         []Tool
 	initialPrompt string
 	model         string
+	tokenBudget   int
+	spentTokens   int
+	onEvent       func(Event)
+	history       []Message
+	dryRun        bool
+	writeLimit    int
+	writes        int
+	overLimit     bool
 }
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// Result is what a run produced. When the run stops early, Reply is the last text the
+// model wrote, if any, and Usage what was spent until then. Messages holds the
+// messages the run added to the conversation, starting with the user's input, so
+// they can be kept as history for the next run. Pending holds the calls held for
+// the user's approval, in the order the model made them.
+type Result struct {
+	Reply      string     `json:"reply"`
+	Usage      Usage      `json:"usage"`
+	Iterations int        `json:"iterations"`
+	Messages   []Message  `json:"-"`
+	Pending    []ToolCall `json:"pending,omitempty"`
 }
 
-type ToolCall struct {
-	Name      string                 `json:"name"`
-	Arguments map[string]interface{} `json:"arguments"`
-}
+var (
+	// ErrTokenBudget stops a run that used up its token budget
+	ErrTokenBudget = errors.New("token budget exhausted")
+	// ErrMaxIterations stops a run that keeps calling tools
+	ErrMaxIterations = errors.New("maximum iterations reached without final response")
+)
 
-func NewAgent(apiKey, context, initialPrompt string, tools []Tool) *Agent {
-	client := openrouter.NewClient(apiKey)
+// maxReplyTokens caps the length of each model reply
+const maxReplyTokens = 1000
 
+// pendingResult tells the model that a call waits for the user's approval
+const pendingResult = "Pending: this change will be made once the user approves it. Don't call it again; tell the user what awaits approval."
+
+// NewAgent runs tools with the given provider, using the provider's default model
+func NewAgent(provider Provider, context, initialPrompt string, tools []Tool) *Agent {
 	return &Agent{
-		client:        client,
+		provider:      provider,
 		context:       context,
 		tools:         tools,
 		initialPrompt: initialPrompt,
-		model:         "google/gemini-2.0-flash-001",
 	}
 }
 
-func (a *Agent) Execute(userInput string) (string, error) {
+// Execute runs the tool loop until the model answers without calling a tool. Calls
+// of one turn run in parallel, except those held for approval, which the result lists
+// as pending. Invalid arguments and tool errors are reported back to
+// the model, which can retry or explain. The run stops early when ctx is done, the
+// token budget is spent or the model fails, returning the partial result with the error.
+func (a *Agent) Execute(ctx context.Context, userInput string) (Result, error) {
 	logger.Info("Starting AI agent execution").
 		Str("user_input", userInput).
 		Str("model", a.model).
@@ -55,142 +92,237 @@ func (a *Agent) Execute(userInput string) (string, error) {
 
 	messages := []Message{
 		{
-			Role:    "system",
+			Role:    RoleSystem,
 			Content: a.buildSystemPrompt(),
 		},
-		{
-			Role:    "user",
-			Content: userInput,
-		},
 	}
-
+	messages = append(messages, a.history...)
+	start := len(messages)
+	messages = append(messages, Message{
+		Role:    RoleUser,
+		Content: userInput,
+	})
+
+	a.writes = 0
+	a.overLimit = false
+	var result Result
+	finish := func(err error) (Result, error) {
+		result.Messages = messages[start:]
+		return result, err
+	}
 	maxIterations := 10
 	for i := 0; i < maxIterations; i++ {
-		logger.Info("Agent iteration").Int("iteration", i+1).Send()
-
-		response, err := a.callModel(messages)
-		if err != nil {
-			logger.Error("Model call failed").Err(err).Send()
-			return "", fmt.Errorf("model call failed: %w", err)
+		if err := ctx.Err(); err != nil {
+			logger.Warn("Agent stopped").Int("iteration", i+1).Err(err).Send()
+			return finish(err)
 		}
 
-		logger.Info("Model response received").Str("response", response).Send()
-
-		toolCall, hasToolCall := a.parseToolCall(response)
-		if !hasToolCall {
-			logger.Info("No tool call found, returning response").Send()
-			return response, nil
+		maxTokens := maxReplyTokens
+		if a.tokenBudget > 0 {
+			remaining := a.tokenBudget - a.spentTokens - result.Usage.TotalTokens
+			if remaining <= 0 {
+				logger.Warn("Agent stopped").Int("iteration", i+1).Int("tokens", result.Usage.TotalTokens).Err(ErrTokenBudget).Send()
+				return finish(ErrTokenBudget)
+			}
+			maxTokens = min(maxTokens, remaining)
 		}
 
-		logger.Info("Tool call detected").Str("tool", toolCall.Name).Send()
+		logger.Info("Agent iteration").Int("iteration", i+1).Send()
 
-		toolResult, err := a.executeTool(toolCall)
+		response, err := a.chat(ctx, i+1, ChatRequest{
+			Model:       a.model,
+			Messages:    messages,
+			Tools:       a.tools,
+			MaxTokens:   maxTokens,
+			Temperature: 0.7,
+		})
+		result.Iterations++
 		if err != nil {
-			logger.Error("Tool execution failed").Str("tool", toolCall.Name).Err(err).Send()
-			return "", fmt.Errorf("tool execution failed: %w", err)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				logger.Warn("Agent stopped").Int("iteration", i+1).Err(ctxErr).Send()
+				return finish(ctxErr)
+			}
+			logger.Error("Model call failed").Err(err).Send()
+			return finish(fmt.Errorf("model call failed: %w", err))
 		}
 
-		messages = append(messages, Message{
-			Role:    "assistant",
-			Content: response,
-		})
+		result.Usage = result.Usage.Add(response.Usage)
+		message := response.Message
+		if message.Content != "" {
+			result.Reply = message.Content
+		}
 
-		messages = append(messages, Message{
-			Role:    "user",
-			Content: fmt.Sprintf("Tool result: %s", toolResult),
-		})
+		messages = append(messages, message)
+		if len(message.ToolCalls) == 0 {
+			logger.Info("No tool call found, returning response").Str("response", message.Content).Int("tokens", result.Usage.TotalTokens).Send()
+			return finish(nil)
+		}
 
-		logger.Info("Tool executed successfully").Str("tool", toolCall.Name).Str("result", toolResult).Send()
+		logger.Info("Tool calls received").Int("count", len(message.ToolCalls)).Send()
+		toolMessages, pending := a.runToolCalls(ctx, i+1, message.ToolCalls)
+		messages = append(messages, toolMessages...)
+		result.Pending = append(result.Pending, pending...)
 	}
 
-	return "", fmt.Errorf("maximum iterations reached without final response")
+	return finish(ErrMaxIterations)
 }
 
 func (a *Agent) buildSystemPrompt() string {
-	var toolsDesc strings.Builder
-	toolsDesc.WriteString("Available tools:\n")
-
-	for _, tool := range a.tools {
-		toolsDesc.WriteString(fmt.Sprintf("- %s: %s\n", tool.Name, tool.Description))
-	}
-
-	toolsDesc.WriteString("\nTo use a tool, respond with: TOOL_CALL: {\"name\": \"tool_name\", \"arguments\": {\"arg1\": \"value1\"}}\n")
-
-	return fmt.Sprintf(`%s
+	prompt := fmt.Sprintf(`%s
 
 Context: %s
 
-%s
-
 Instructions:
 - Use the available tools to complete tasks
-- Always respond with either a tool call or a final answer
-- If you need to use a tool, format your response as specified above
-- Provide clear and helpful responses`, a.initialPrompt, a.context, toolsDesc.String())
+- Call independent tools together in one turn
+- If a tool returns an error, fix the arguments and try again or explain the problem
+- Provide clear and helpful responses`, a.initialPrompt, a.context)
+
+	if a.dryRun {
+		prompt += "\n- This is a dry run: changes are only planned, and made once the user approves them"
+	} else if a.writeLimit > 0 || slices.ContainsFunc(a.tools, func(tool Tool) bool { return tool.RequiresConfirmation }) {
+		prompt += "\n- Some changes need the user's approval and are made once they approve them"
+		if a.writeLimit > 0 {
+			prompt += fmt.Sprintf("\n- Only the first %d changes to existing items are made right away; the rest wait for the user's approval", a.writeLimit)
+		}
+	}
+	return prompt
 }
 
-func (a *Agent) callModel(messages []Message) (string, error) {
-	request := openrouter.ChatCompletionRequest{
-		Model:       a.model,
-		MaxTokens:   1000,
-		Temperature: 0.7,
-	}
+// holds reports whether calls of the tool wait for the user's approval
+func (a *Agent) holds(tool Tool) bool {
+	return tool.RequiresConfirmation || (a.dryRun && !tool.ReadOnly)
+}
 
-	for _, msg := range messages {
-		request.Messages = append(request.Messages, openrouter.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: openrouter.Content{Text: msg.Content},
-		})
-	}
+// countsAsWrite reports whether calls of the tool count towards the write limit
+func countsAsWrite(tool Tool) bool {
+	return !tool.ReadOnly && !tool.Additive
+}
 
-	response, err := a.client.CreateChatCompletion(context.Background(), request)
-	if err != nil {
-		return "", err
+// chat asks the model for its next message, streaming the reply text to the event
+// handler when there is one and the provider supports it
+func (a *Agent) chat(ctx context.Context, iteration int, request ChatRequest) (ChatResponse, error) {
+	streaming, ok := a.provider.(StreamingProvider)
+	if a.onEvent == nil || !ok {
+		return a.provider.Chat(ctx, request)
 	}
+	return streaming.ChatStream(ctx, request, func(text string) {
+		a.onEvent(Event{Type: EventToken, Iteration: iteration, Text: text})
+	})
+}
 
-	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
+// runToolCalls runs the calls of one model turn in parallel and returns their results
+// as tool messages, in the order the model made the calls. Failures become the
+// result, prefixed with "Error:", so the model sees them. Valid calls of held tools
+// don't run; they are returned as pending instead. So are the writes of the turn
+// that would take the run over the write limit, and every write after it. Writes of
+// earlier turns within the limit have already run.
+func (a *Agent) runToolCalls(ctx context.Context, iteration int, calls []ToolCall) ([]Message, []ToolCall) {
+	tools := make([]*Tool, len(calls))
+	turnWrites := 0
+	for i, call := range calls {
+		if tool, _, err := prepareCall(a.tools, call); err == nil {
+			tools[i] = &tool
+			if countsAsWrite(tool) && !a.holds(tool) {
+				turnWrites++
+			}
+		}
+	}
+	bulk := a.overLimit || (a.writeLimit > 0 && a.writes+turnWrites > a.writeLimit)
+	if bulk {
+		logger.Info("Bulk change held for approval").Int("writes", turnWrites).Int("limit", a.writeLimit).Send()
+		a.overLimit = true
+	} else {
+		a.writes += turnWrites
 	}
 
-	return response.Choices[0].Message.Content.Text, nil
-}
-
-func (a *Agent) parseToolCall(response string) (ToolCall, bool) {
-	const toolCallPrefix = "TOOL_CALL: "
+	results := make([]Message, len(calls))
+	var pending []ToolCall
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		if tool := tools[i]; tool != nil && (a.holds(*tool) || (bulk && countsAsWrite(*tool))) {
+			logger.Info("Tool call held for approval").Str("tool", call.Name).Send()
+			a.emit(Event{Type: EventToolPending, Iteration: iteration, ToolCall: &call})
+			pending = append(pending, call)
+			results[i] = Message{Role: RoleTool, Content: pendingResult, ToolCallID: call.ID}
+			continue
+		}
 
-	if !strings.Contains(response, toolCallPrefix) {
-		return ToolCall{}, false
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.emit(Event{Type: EventToolStart, Iteration: iteration, ToolCall: &call})
+			result, err := CallTool(ctx, a.tools, call)
+			finish := Event{Type: EventToolFinish, Iteration: iteration, ToolCall: &call, Result: result}
+			if err != nil {
+				result = fmt.Sprintf("Error: %s", err)
+				finish.Error = err.Error()
+			}
+			a.emit(finish)
+			results[i] = Message{
+				Role:       RoleTool,
+				Content:    result,
+				ToolCallID: call.ID,
+			}
+		}()
 	}
+	wg.Wait()
+	return results, pending
+}
 
-	start := strings.Index(response, toolCallPrefix)
-	if start == -1 {
-		return ToolCall{}, false
+// CallTool decodes, validates and executes a call with one of the tools, whatever
+// their confirmation policy, e.g. once the user approved it. Nothing runs once ctx
+// is done.
+func CallTool(ctx context.Context, tools []Tool, call ToolCall) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
 	}
 
-	jsonStr := response[start+len(toolCallPrefix):]
-
-	lines := strings.Split(jsonStr, "\n")
-	if len(lines) > 0 {
-		jsonStr = lines[0]
+	tool, args, err := prepareCall(tools, call)
+	if err != nil {
+		logger.Error("Invalid tool call").Str("tool", call.Name).Str("json", call.Arguments).Err(err).Send()
+		return "", err
 	}
 
-	var toolCall ToolCall
-	if err := json.Unmarshal([]byte(jsonStr), &toolCall); err != nil {
-		logger.Error("Failed to parse tool call").Str("json", jsonStr).Err(err).Send()
-		return ToolCall{}, false
+	logger.Info("Tool call detected").Str("tool", call.Name).Send()
+	result, err := tool.Function(ctx, args)
+	if err != nil {
+		logger.Error("Tool execution failed").Str("tool", call.Name).Err(err).Send()
+		return "", err
 	}
 
-	return toolCall, true
+	logger.Info("Tool executed successfully").Str("tool", call.Name).Str("result", result).Send()
+	if result == "" {
+		return "OK", nil
+	}
+	return result, nil
 }
 
-func (a *Agent) executeTool(toolCall ToolCall) (string, error) {
-	for _, tool := range a.tools {
-		if tool.Name == toolCall.Name {
-			return tool.Function(toolCall.Arguments)
+// prepareCall finds the tool a call names and decodes and validates its arguments
+func prepareCall(tools []Tool, call ToolCall) (Tool, map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	if strings.TrimSpace(call.Arguments) != "" {
+		if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+			return Tool{}, nil, fmt.Errorf("arguments are not a JSON object: %w", err)
+		}
+	}
+
+	for _, tool := range tools {
+		if tool.Name == call.Name {
+			if err := ValidateArguments(tool.Parameters, args); err != nil {
+				return Tool{}, nil, err
+			}
+			return tool, args, nil
 		}
 	}
+	return Tool{}, nil, fmt.Errorf("tool not found: %s", call.Name)
+}
 
-	return "", fmt.Errorf("tool not found: %s", toolCall.Name)
+// emit passes an event to the handler, if any
+func (a *Agent) emit(event Event) {
+	if a.onEvent != nil {
+		a.onEvent(event)
+	}
 }
 
 func (a *Agent) AddTool(tool Tool) {
@@ -201,6 +333,43 @@ func (a *Agent) SetModel(model string) {
 	a.model = model
 }
 
+// OnEvent sets a handler for the progress of runs. Parallel tool calls report
+// concurrently, so the handler must be safe for concurrent use.
+func (a *Agent) OnEvent(handler func(Event)) {
+	a.onEvent = handler
+}
+
+// SetDryRun makes the agent only plan changes: calls of tools that aren't ReadOnly
+// are returned as pending instead of running
+func (a *Agent) SetDryRun(dryRun bool) {
+	a.dryRun = dryRun
+}
+
+// SetWriteLimit holds the changes of a run for approval once it makes more than
+// limit of them, 0 for no limit. The first limit changes are made right away; from
+// the turn that goes over the limit on, every change is held. ReadOnly and Additive
+// tools don't count.
+func (a *Agent) SetWriteLimit(limit int) {
+	a.writeLimit = limit
+}
+
+// SetTokenBudget limits the tokens a run may use, 0 for no limit
+func (a *Agent) SetTokenBudget(tokens int) {
+	a.tokenBudget = tokens
+}
+
+// SetSpentTokens counts tokens already spent for the run outside the agent, e.g. on
+// summarizing its history, against the token budget
+func (a *Agent) SetSpentTokens(tokens int) {
+	a.spentTokens = tokens
+}
+
+// SetHistory sets earlier messages of the conversation, sent between the system prompt
+// and the user's input
+func (a *Agent) SetHistory(messages []Message) {
+	a.history = messages
+}
+
 func (a *Agent) SetContext(context string) {
 	a.context = context
 }
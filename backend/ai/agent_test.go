@@ -0,0 +1,349 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var taskIDSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"task_id": map[string]interface{}{"type": "integer"},
+	},
+	"required":             []string{"task_id"},
+	"additionalProperties": false,
+}
+
+// toolMessages returns the tool results the agent sent with the given request
+func toolMessages(t *testing.T, provider *ScriptedProvider, request int) map[string]string {
+	t.Helper()
+	if len(provider.Requests) <= request {
+		t.Fatalf("got %d requests, want more than %d", len(provider.Requests), request)
+	}
+	results := map[string]string{}
+	for _, message := range provider.Requests[request].Messages {
+		if message.Role == RoleTool {
+			results[message.ToolCallID] = message.Content
+		}
+	}
+	return results
+}
+
+func TestExecuteReply(t *testing.T) {
+	provider := NewScriptedProvider(Reply("Nothing to do"))
+	provider.UsagePerReply = Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	agent := NewAgent(provider, "Today is Monday", "You manage tasks.", nil)
+
+	result, err := agent.Execute(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Reply != "Nothing to do" || result.Iterations != 1 || result.Usage.TotalTokens != 15 {
+		t.Errorf("got %+v", result)
+	}
+
+	messages := provider.Requests[0].Messages
+	if len(messages) != 2 || messages[0].Role != RoleSystem || messages[1].Content != "hello" {
+		t.Fatalf("got messages %+v", messages)
+	}
+	if !strings.Contains(messages[0].Content, "You manage tasks.") || !strings.Contains(messages[0].Content, "Today is Monday") {
+		t.Errorf("system prompt lacks prompt or context: %q", messages[0].Content)
+	}
+	if len(result.Messages) != 2 || result.Messages[0].Role != RoleUser || result.Messages[1].Content != "Nothing to do" {
+		t.Errorf("got run messages %+v", result.Messages)
+	}
+}
+
+func TestExecuteParallelToolCalls(t *testing.T) {
+	// Each call waits for the other, so they only finish when run at the same time
+	started := map[string]chan struct{}{"a": make(chan struct{}), "b": make(chan struct{})}
+	other := map[string]string{"a": "b", "b": "a"}
+	wait := func(ctx context.Context, args map[string]interface{}) (string, error) {
+		name := args["name"].(string)
+		close(started[name])
+		select {
+		case <-started[other[name]]:
+			return "done " + name, nil
+		case <-time.After(time.Second):
+			return "", errors.New("calls ran one after the other")
+		}
+	}
+	tools := []Tool{{
+		Name:       "wait",
+		Parameters: map[string]interface{}{"type": "object", "properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}}},
+		Function:   wait,
+	}}
+	provider := NewScriptedProvider(
+		CallTools(
+			ToolCall{ID: "1", Name: "wait", Arguments: `{"name": "a"}`},
+			ToolCall{ID: "2", Name: "wait", Arguments: `{"name": "b"}`},
+		),
+		Reply("Both done"),
+	)
+
+	result, err := NewAgent(provider, "", "", tools).Execute(context.Background(), "run both")
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Reply != "Both done" || result.Iterations != 2 {
+		t.Errorf("got %+v", result)
+	}
+
+	results := toolMessages(t, provider, 1)
+	if results["1"] != "done a" || results["2"] != "done b" {
+		t.Errorf("got tool results %v", results)
+	}
+	// Results follow the order of the calls
+	messages := provider.Requests[1].Messages
+	if messages[len(messages)-2].ToolCallID != "1" || messages[len(messages)-1].ToolCallID != "2" {
+		t.Errorf("tool results out of order: %+v", messages)
+	}
+}
+
+func TestExecuteToolErrorIsReported(t *testing.T) {
+	tools := []Tool{{
+		Name:       "complete_task",
+		Parameters: taskIDSchema,
+		Function: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			return "", errors.New("task 7 not found")
+		},
+	}}
+	provider := NewScriptedProvider(
+		CallTools(ToolCall{ID: "1", Name: "complete_task", Arguments: `{"task_id": 7}`}),
+		Reply("Task 7 doesn't exist"),
+	)
+
+	result, err := NewAgent(provider, "", "", tools).Execute(context.Background(), "complete task 7")
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Reply != "Task 7 doesn't exist" {
+		t.Errorf("got reply %q", result.Reply)
+	}
+	if got := toolMessages(t, provider, 1)["1"]; got != "Error: task 7 not found" {
+		t.Errorf("got tool result %q", got)
+	}
+}
+
+func TestExecuteRejectsInvalidArguments(t *testing.T) {
+	var calls atomic.Int32
+	tools := []Tool{{
+		Name:       "complete_task",
+		Parameters: taskIDSchema,
+		Function: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			calls.Add(1)
+			return "ok", nil
+		},
+	}}
+	provider := NewScriptedProvider(
+		CallTools(
+			ToolCall{ID: "1", Name: "complete_task", Arguments: `{"task_id": "seven"}`},
+			ToolCall{ID: "2", Name: "complete_task", Arguments: `{}`},
+			ToolCall{ID: "3", Name: "complete_task", Arguments: `{"task_id": 7, "force": true}`},
+			ToolCall{ID: "4", Name: "complete_task", Arguments: `not json`},
+			ToolCall{ID: "5", Name: "delete_task", Arguments: `{"task_id": 7}`},
+		),
+		Reply("Sorry"),
+	)
+
+	if _, err := NewAgent(provider, "", "", tools).Execute(context.Background(), "complete task 7"); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("tool ran %d times with invalid arguments", n)
+	}
+
+	want := map[string]string{
+		"1": "Error: arguments.task_id must be integer",
+		"2": "Error: arguments.task_id is required",
+		"3": "Error: arguments.force is not a known argument",
+		"4": "Error: arguments are not a JSON object",
+		"5": "Error: tool not found: delete_task",
+	}
+	results := toolMessages(t, provider, 1)
+	for id, prefix := range want {
+		if !strings.HasPrefix(results[id], prefix) {
+			t.Errorf("call %s: got %q, want %q", id, results[id], prefix)
+		}
+	}
+}
+
+func TestExecuteCountsSpentTokensAgainstBudget(t *testing.T) {
+	provider := NewScriptedProvider(Reply("never reached"))
+	agent := NewAgent(provider, "", "", nil)
+	agent.SetTokenBudget(100)
+	agent.SetSpentTokens(100)
+
+	if _, err := agent.Execute(context.Background(), "hello"); !errors.Is(err, ErrTokenBudget) {
+		t.Fatalf("got error %v, want ErrTokenBudget", err)
+	}
+	if len(provider.Requests) != 0 {
+		t.Errorf("got %d requests, want none", len(provider.Requests))
+	}
+}
+
+func TestExecuteStopsAtTokenBudget(t *testing.T) {
+	tools := []Tool{{
+		Name:     "noop",
+		Function: func(ctx context.Context, args map[string]interface{}) (string, error) { return "", nil },
+	}}
+	provider := NewScriptedProvider(
+		CallTools(ToolCall{ID: "1", Name: "noop"}),
+		CallTools(ToolCall{ID: "2", Name: "noop"}),
+		Reply("never reached"),
+	)
+	provider.UsagePerReply = Usage{TotalTokens: 60}
+	agent := NewAgent(provider, "", "", tools)
+	agent.SetTokenBudget(100)
+
+	result, err := agent.Execute(context.Background(), "loop")
+	if !errors.Is(err, ErrTokenBudget) {
+		t.Fatalf("got error %v, want ErrTokenBudget", err)
+	}
+	if result.Iterations != 2 || result.Usage.TotalTokens != 120 {
+		t.Errorf("got %+v", result)
+	}
+}
+
+// countingTool returns a tool that counts its calls in runs
+func countingTool(name string, runs *atomic.Int32) Tool {
+	return Tool{
+		Name: name,
+		Function: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			runs.Add(1)
+			return "done", nil
+		},
+	}
+}
+
+// pendingIDs returns the IDs of the calls a run held for approval
+func pendingIDs(result Result) string {
+	var ids []string
+	for _, call := range result.Pending {
+		ids = append(ids, call.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestExecuteHoldsToolsRequiringConfirmation(t *testing.T) {
+	var deletes, lists atomic.Int32
+	deleteTool := countingTool("delete_task", &deletes)
+	deleteTool.RequiresConfirmation = true
+	listTool := countingTool("list_tasks", &lists)
+	listTool.ReadOnly = true
+	provider := NewScriptedProvider(
+		CallTools(ToolCall{ID: "1", Name: "list_tasks"}, ToolCall{ID: "2", Name: "delete_task"}),
+		Reply("Task 2 will be deleted once you approve"),
+	)
+
+	result, err := NewAgent(provider, "", "", []Tool{deleteTool, listTool}).Execute(context.Background(), "delete task 2")
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if deletes.Load() != 0 || lists.Load() != 1 {
+		t.Errorf("got %d deletes and %d lists, want 0 and 1", deletes.Load(), lists.Load())
+	}
+	if got := pendingIDs(result); got != "2" {
+		t.Errorf("got pending calls %q, want 2", got)
+	}
+	if got := toolMessages(t, provider, 1)["2"]; got != pendingResult {
+		t.Errorf("got tool result %q", got)
+	}
+	if !strings.Contains(provider.Requests[0].Messages[0].Content, "need the user's approval") {
+		t.Error("system prompt doesn't mention approval")
+	}
+}
+
+func TestExecuteDryRunOnlyRunsReadOnlyTools(t *testing.T) {
+	var lists, creates, moves atomic.Int32
+	listTool := countingTool("list_tasks", &lists)
+	listTool.ReadOnly = true
+	createTool := countingTool("create_task", &creates)
+	createTool.Additive = true
+	moveTool := countingTool("move_task", &moves)
+	provider := NewScriptedProvider(
+		CallTools(ToolCall{ID: "1", Name: "list_tasks"}, ToolCall{ID: "2", Name: "create_task"}, ToolCall{ID: "3", Name: "move_task"}),
+		Reply("Planned"),
+	)
+	agent := NewAgent(provider, "", "", []Tool{listTool, createTool, moveTool})
+	agent.SetDryRun(true)
+
+	result, err := agent.Execute(context.Background(), "plan my day")
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if lists.Load() != 1 || creates.Load() != 0 || moves.Load() != 0 {
+		t.Errorf("got %d lists, %d creates and %d moves, want 1, 0 and 0", lists.Load(), creates.Load(), moves.Load())
+	}
+	if got := pendingIDs(result); got != "2,3" {
+		t.Errorf("got pending calls %q, want 2,3", got)
+	}
+	if !strings.Contains(provider.Requests[0].Messages[0].Content, "dry run") {
+		t.Error("system prompt doesn't mention the dry run")
+	}
+}
+
+func TestExecuteWriteLimitHoldsLaterWrites(t *testing.T) {
+	var creates, moves atomic.Int32
+	createTool := countingTool("create_task", &creates)
+	createTool.Additive = true
+	moveTool := countingTool("move_task", &moves)
+	// One write per turn: the third goes over the limit, and every write after it is
+	// held even when it alone would fit
+	provider := NewScriptedProvider(
+		CallTools(ToolCall{ID: "1", Name: "move_task"}),
+		CallTools(ToolCall{ID: "2", Name: "move_task"}, ToolCall{ID: "3", Name: "create_task"}),
+		CallTools(ToolCall{ID: "4", Name: "move_task"}),
+		CallTools(ToolCall{ID: "5", Name: "create_task"}, ToolCall{ID: "6", Name: "move_task"}),
+		Reply("Moved two, the rest await approval"),
+		CallTools(ToolCall{ID: "7", Name: "move_task"}),
+		Reply("Moved"),
+	)
+	agent := NewAgent(provider, "", "", []Tool{createTool, moveTool})
+	agent.SetWriteLimit(2)
+
+	result, err := agent.Execute(context.Background(), "move all errands")
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if moves.Load() != 2 || creates.Load() != 2 {
+		t.Errorf("got %d moves and %d creates, want 2 and 2", moves.Load(), creates.Load())
+	}
+	if got := pendingIDs(result); got != "4,6" {
+		t.Errorf("got pending calls %q, want 4,6", got)
+	}
+	if !strings.Contains(provider.Requests[0].Messages[0].Content, "first 2 changes") {
+		t.Error("system prompt doesn't mention the write limit")
+	}
+
+	// The next run starts counting afresh
+	if result, err = agent.Execute(context.Background(), "move one"); err != nil || len(result.Pending) != 0 {
+		t.Errorf("got pending %v, error %v, want the move to run", result.Pending, err)
+	}
+}
+
+func TestExecuteWriteLimitHoldsTurnAsWhole(t *testing.T) {
+	var moves atomic.Int32
+	moveTool := countingTool("move_task", &moves)
+	provider := NewScriptedProvider(
+		CallTools(ToolCall{ID: "1", Name: "move_task"}, ToolCall{ID: "2", Name: "move_task"}, ToolCall{ID: "3", Name: "move_task"}),
+		Reply("Waiting for approval"),
+	)
+	agent := NewAgent(provider, "", "", []Tool{moveTool})
+	agent.SetWriteLimit(2)
+
+	result, err := agent.Execute(context.Background(), "move three")
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if moves.Load() != 0 {
+		t.Errorf("got %d moves, want none", moves.Load())
+	}
+	if got := pendingIDs(result); got != "1,2,3" {
+		t.Errorf("got pending calls %q, want 1,2,3", got)
+	}
+}
@@ -0,0 +1,195 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/revrost/go-openrouter"
+)
+
+// DefaultOpenRouterModel is the model used through OpenRouter unless another is set
+const DefaultOpenRouterModel = "google/gemini-2.0-flash-001"
+
+// chatCompletionProvider talks to an OpenAI-compatible chat completions API
+type chatCompletionProvider struct {
+	client *openrouter.Client
+	model  string
+}
+
+// NewOpenRouterProvider uses OpenRouter, with DefaultOpenRouterModel when model is empty
+func NewOpenRouterProvider(apiKey, model string) Provider {
+	if model == "" {
+		model = DefaultOpenRouterModel
+	}
+	return &chatCompletionProvider{client: openrouter.NewClient(apiKey), model: model}
+}
+
+// NewOpenAICompatibleProvider uses any server with an OpenAI-compatible API under
+// baseURL, such as Ollama (http://localhost:11434/v1) or llama.cpp's server. Local
+// servers usually ignore the API key.
+func NewOpenAICompatibleProvider(baseURL, apiKey, model string) Provider {
+	config := openrouter.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	return &chatCompletionProvider{client: openrouter.NewClientWithConfig(*config), model: model}
+}
+
+// completionRequest translates a chat request to the chat completions API
+func (p *chatCompletionProvider) completionRequest(request ChatRequest) (openrouter.ChatCompletionRequest, error) {
+	model := request.Model
+	if model == "" {
+		model = p.model
+	}
+	if model == "" {
+		return openrouter.ChatCompletionRequest{}, fmt.Errorf("no model configured")
+	}
+
+	completion := openrouter.ChatCompletionRequest{
+		Model:       model,
+		MaxTokens:   request.MaxTokens,
+		Temperature: request.Temperature,
+	}
+
+	for _, msg := range request.Messages {
+		message := openrouter.ChatCompletionMessage{
+			Role:       msg.Role,
+			Content:    openrouter.Content{Text: msg.Content},
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, call := range msg.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, openrouter.ToolCall{
+				ID:       call.ID,
+				Type:     openrouter.ToolTypeFunction,
+				Function: openrouter.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+		completion.Messages = append(completion.Messages, message)
+	}
+
+	for _, tool := range request.Tools {
+		completion.Tools = append(completion.Tools, openrouter.Tool{
+			Type: openrouter.ToolTypeFunction,
+			Function: &openrouter.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if len(completion.Tools) > 0 {
+		completion.ToolChoice = "auto"
+		completion.ParallelToolCalls = true
+	}
+	return completion, nil
+}
+
+func (p *chatCompletionProvider) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	completion, err := p.completionRequest(request)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	response, err := p.client.CreateChatCompletion(ctx, completion)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	if len(response.Choices) == 0 {
+		return ChatResponse{}, fmt.Errorf("no choices in response")
+	}
+
+	reply := response.Choices[0].Message
+	message := Message{Role: RoleAssistant, Content: reply.Content.Text}
+	for _, call := range reply.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	result := ChatResponse{Message: message}
+	if response.Usage != nil {
+		result.Usage = Usage{
+			PromptTokens:     response.Usage.PromptTokens,
+			CompletionTokens: response.Usage.CompletionTokens,
+			TotalTokens:      response.Usage.TotalTokens,
+		}
+	}
+	return result, nil
+}
+
+// ChatStream streams the reply, passing text to onDelta as it arrives and piecing
+// tool calls together from their fragments
+func (p *chatCompletionProvider) ChatStream(ctx context.Context, request ChatRequest, onDelta func(text string)) (ChatResponse, error) {
+	completion, err := p.completionRequest(request)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	completion.StreamOptions = &openrouter.StreamOptions{IncludeUsage: true}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, completion)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	var calls []*ToolCall
+	callsByIndex := map[int]*ToolCall{}
+	var result ChatResponse
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ChatResponse{}, err
+		}
+
+		if chunk.Usage != nil {
+			result.Usage = Usage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			onDelta(delta.Content)
+		}
+		for i, fragment := range delta.ToolCalls {
+			index := i
+			if fragment.Index != nil {
+				index = *fragment.Index
+			}
+			call, ok := callsByIndex[index]
+			if !ok {
+				call = &ToolCall{}
+				callsByIndex[index] = call
+				calls = append(calls, call)
+			}
+			if fragment.ID != "" {
+				call.ID = fragment.ID
+			}
+			call.Name += fragment.Function.Name
+			call.Arguments += fragment.Function.Arguments
+		}
+	}
+
+	// The stream ends quietly when ctx is cancelled
+	if err := ctx.Err(); err != nil {
+		return ChatResponse{}, err
+	}
+
+	result.Message = Message{Role: RoleAssistant, Content: content.String()}
+	for _, call := range calls {
+		result.Message.ToolCalls = append(result.Message.ToolCalls, *call)
+	}
+	return result, nil
+}
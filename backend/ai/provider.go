@@ -0,0 +1,66 @@
+package ai
+
+import "context"
+
+// Message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Provider is a chat model that can call tools
+type Provider interface {
+	// Chat sends the conversation and returns the model's next message. It gives up
+	// when ctx is done.
+	Chat(ctx context.Context, request ChatRequest) (ChatResponse, error)
+}
+
+// ChatRequest is one turn of a conversation. An empty Model uses the provider's default.
+type ChatRequest struct {
+	Model       string
+	Messages    []Message
+	Tools       []Tool
+	MaxTokens   int
+	Temperature float32
+}
+
+// ChatResponse is the model's reply with the tokens the turn used
+type ChatResponse struct {
+	Message Message
+	Usage   Usage
+}
+
+// Usage counts tokens. Providers that don't report usage leave it zero.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add sums two usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// Message is a chat message. Assistant messages may carry tool calls, and tool
+// messages answer the call with ToolCallID.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall is a call the model asked for. Arguments is the JSON object as the model
+// wrote it, so malformed arguments can be reported back.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
@@ -0,0 +1,132 @@
+package ai
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ValidateArguments checks decoded JSON arguments against a tool's JSON schema. It
+// covers the parts of JSON Schema tool definitions use: type, properties, required,
+// additionalProperties, items and enum. Errors name the offending argument so the
+// model can correct its call.
+func ValidateArguments(schema map[string]interface{}, args map[string]interface{}) error {
+	if schema == nil {
+		return nil
+	}
+	return validateValue(schema, args, "arguments")
+}
+
+func validateValue(schema map[string]interface{}, value interface{}, path string) error {
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s must be %s", path, strings.Join(types, " or "))
+		}
+	}
+
+	if enum, ok := schema["enum"]; ok {
+		if !slices.ContainsFunc(toSlice(enum), func(allowed interface{}) bool { return fmt.Sprint(allowed) == fmt.Sprint(value) }) {
+			return fmt.Errorf("%s must be one of %v", path, toSlice(enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, name := range toSlice(schema["required"]) {
+			if _, ok := v[fmt.Sprint(name)]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+
+		// Check in a fixed order so the same call always reports the same error
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			propertySchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					return fmt.Errorf("%s.%s is not a known argument", path, name)
+				}
+				continue
+			}
+			if err := validateValue(propertySchema, v[name], path+"."+name); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateValue(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// schemaTypes reads a schema's type, which is a name or a list of names
+func schemaTypes(t interface{}) []string {
+	var types []string
+	for _, item := range toSlice(t) {
+		types = append(types, fmt.Sprint(item))
+	}
+	return types
+}
+
+// toSlice turns the slices a schema literal may hold, or a single value, into a list
+func toSlice(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, s := range v {
+			list[i] = s
+		}
+		return list
+	default:
+		return []interface{}{v}
+	}
+}
+
+func hasType(value interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
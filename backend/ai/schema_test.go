@@ -0,0 +1,57 @@
+package ai
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateArguments(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"description": map[string]interface{}{"type": "string"},
+			"priority":    map[string]interface{}{"type": "integer", "enum": []interface{}{1, 2, 3}},
+			"labels":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			"due":         map[string]interface{}{"type": []string{"string", "null"}},
+		},
+		"required":             []string{"description"},
+		"additionalProperties": false,
+	}
+
+	tests := []struct {
+		args string
+		err  string
+	}{
+		{`{"description": "Buy milk"}`, ""},
+		{`{"description": "Buy milk", "priority": 2, "labels": ["home"], "due": null}`, ""},
+		{`{"description": "Buy milk", "due": "2024-05-01"}`, ""},
+		{`{}`, "arguments.description is required"},
+		{`{"description": 5}`, "arguments.description must be string"},
+		{`{"description": "x", "priority": 2.5}`, "arguments.priority must be integer"},
+		{`{"description": "x", "priority": 4}`, "arguments.priority must be one of [1 2 3]"},
+		{`{"description": "x", "labels": ["home", 3]}`, "arguments.labels[1] must be string"},
+		{`{"description": "x", "labels": "home"}`, "arguments.labels must be array"},
+		{`{"description": "x", "due": 3}`, "arguments.due must be string or null"},
+		{`{"description": "x", "color": "red"}`, "arguments.color is not a known argument"},
+	}
+	for _, tt := range tests {
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.args), &args); err != nil {
+			t.Fatalf("bad test arguments %s: %v", tt.args, err)
+		}
+
+		err := ValidateArguments(schema, args)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.args, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%s: got error %v, want %q", tt.args, err, tt.err)
+		}
+	}
+}
+
+func TestValidateArgumentsWithoutSchema(t *testing.T) {
+	if err := ValidateArguments(nil, map[string]interface{}{"anything": true}); err != nil {
+		t.Errorf("got %v, want no error without a schema", err)
+	}
+}
@@ -0,0 +1,61 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ScriptedProvider is a stand-in model that replies with a fixed list of messages,
+// one per call, and records the requests it got. It lets agent flows run offline.
+// Each reply reports UsagePerReply tokens.
+type ScriptedProvider struct {
+	mu            sync.Mutex
+	replies       []Message
+	Requests      []ChatRequest
+	UsagePerReply Usage
+}
+
+// NewScriptedProvider replies with the given messages in order
+func NewScriptedProvider(replies ...Message) *ScriptedProvider {
+	return &ScriptedProvider{replies: replies}
+}
+
+// Reply returns an assistant message with the given text
+func Reply(content string) Message {
+	return Message{Role: RoleAssistant, Content: content}
+}
+
+// CallTools returns an assistant message calling the given tools
+func CallTools(calls ...ToolCall) Message {
+	return Message{Role: RoleAssistant, ToolCalls: calls}
+}
+
+func (p *ScriptedProvider) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return ChatResponse{}, err
+	}
+	p.Requests = append(p.Requests, request)
+	if len(p.Requests) > len(p.replies) {
+		return ChatResponse{}, fmt.Errorf("script has no reply for request %d", len(p.Requests))
+	}
+	return ChatResponse{Message: p.replies[len(p.Requests)-1], Usage: p.UsagePerReply}, nil
+}
+
+// ChatStream replies like Chat, passing the reply text to onDelta word by word
+func (p *ScriptedProvider) ChatStream(ctx context.Context, request ChatRequest, onDelta func(text string)) (ChatResponse, error) {
+	response, err := p.Chat(ctx, request)
+	if err != nil {
+		return response, err
+	}
+	for _, word := range strings.SplitAfter(response.Message.Content, " ") {
+		if word != "" {
+			onDelta(word)
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,29 @@
+package ai
+
+import "context"
+
+// StreamingProvider is a Provider that can also deliver the reply text as it's written
+type StreamingProvider interface {
+	Provider
+	// ChatStream is Chat, calling onDelta with each piece of reply text as it arrives
+	ChatStream(ctx context.Context, request ChatRequest, onDelta func(text string)) (ChatResponse, error)
+}
+
+// Event types
+const (
+	EventToken       = "token"
+	EventToolStart   = "tool_start"
+	EventToolFinish  = "tool_finish"
+	EventToolPending = "tool_pending"
+)
+
+// Event reports the progress of a run: reply text as the model writes it, each tool
+// call as it starts and finishes, and calls held for the user's approval
+type Event struct {
+	Type      string    `json:"type"`
+	Iteration int       `json:"iteration"`
+	Text      string    `json:"text,omitempty"`
+	ToolCall  *ToolCall `json:"tool_call,omitempty"`
+	Result    string    `json:"result,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
@@ -0,0 +1,95 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// messageOverhead roughly counts the tokens of a message's role and framing
+const messageOverhead = 4
+
+const summaryPrompt = `You keep the memory of a conversation between the user and an assistant that
+manages their tasks and notes. Write a short summary of the conversation below for the
+assistant to continue from: what the user asked for, what was done (with task and note IDs),
+decisions and preferences, and anything left open. Answer with the summary only.`
+
+// EstimateTokens roughly counts the tokens of messages, at about four characters a
+// token. It errs on the high side for most text, which is what budgets need.
+func EstimateTokens(messages []Message) int {
+	tokens := 0
+	for _, message := range messages {
+		chars := len(message.Content)
+		for _, call := range message.ToolCalls {
+			chars += len(call.Name) + len(call.Arguments)
+		}
+		tokens += messageOverhead + (chars+3)/4
+	}
+	return tokens
+}
+
+// SplitHistory divides a conversation whose estimate exceeds budget into older
+// messages to summarize and recent ones to keep, which take up to half the budget.
+// The recent part starts with a user message, so tool calls stay with their results.
+// Older is empty when the whole history fits.
+func SplitHistory(messages []Message, budget int) (older, recent []Message) {
+	if EstimateTokens(messages) <= budget {
+		return nil, messages
+	}
+
+	cut := len(messages)
+	tokens := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		tokens += EstimateTokens(messages[i : i+1])
+		if tokens > budget/2 {
+			break
+		}
+		if messages[i].Role == RoleUser {
+			cut = i
+		}
+	}
+	return messages[:cut], messages[cut:]
+}
+
+// Summarize folds messages into the previous summary of a conversation, which may
+// be empty, and returns the new summary
+func Summarize(ctx context.Context, provider Provider, previous string, messages []Message) (string, Usage, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&transcript, "Summary so far:\n%s\n\n", previous)
+	}
+	transcript.WriteString("Conversation:\n")
+	for _, message := range messages {
+		switch {
+		case len(message.ToolCalls) > 0:
+			for _, call := range message.ToolCalls {
+				fmt.Fprintf(&transcript, "assistant called %s(%s)\n", call.Name, call.Arguments)
+			}
+			if message.Content != "" {
+				fmt.Fprintf(&transcript, "assistant: %s\n", message.Content)
+			}
+		case message.Role == RoleTool:
+			fmt.Fprintf(&transcript, "tool result: %s\n", message.Content)
+		default:
+			fmt.Fprintf(&transcript, "%s: %s\n", message.Role, message.Content)
+		}
+	}
+
+	response, err := provider.Chat(ctx, ChatRequest{
+		Messages: []Message{
+			{Role: RoleSystem, Content: summaryPrompt},
+			{Role: RoleUser, Content: transcript.String()},
+		},
+		MaxTokens:   maxReplyTokens,
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return "", response.Usage, fmt.Errorf("summarizing failed: %w", err)
+	}
+
+	summary := strings.TrimSpace(response.Message.Content)
+	if summary == "" {
+		return "", response.Usage, fmt.Errorf("summarizing failed: empty summary")
+	}
+	return summary, response.Usage, nil
+}
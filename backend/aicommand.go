@@ -0,0 +1,620 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dima-b/go-task-backend/ai"
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/env"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+)
+
+// aiProvider runs AI commands, nil when they aren't configured
+var aiProvider ai.Provider
+
+// maxCommandTasks caps how many tasks list_tasks hands to the model
+const maxCommandTasks = 100
+
+const commandPrompt = `You manage the user's tasks and notes. Carry out their command with the tools,
+looking tasks up with list_tasks or search before changing them. Dates are YYYY-MM-DD.
+When you are done, answer with a short summary of what you changed.`
+
+// AICommandRequest is a command for the agent. A dry run only plans the changes,
+// returning them as a plan to approve.
+type AICommandRequest struct {
+	Text   string `json:"text"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// AIAction is a tool call the agent made while running a command
+type AIAction struct {
+	Tool      string          `json:"tool"`
+	Arguments map[string]any  `json:"arguments"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// AICommandResponse describes what a command did. When the agent stops early, e.g.
+// on the timeout or token budget, Reply and Actions hold what it got done. Plan holds
+// the changes waiting for the user's approval, if any.
+type AICommandResponse struct {
+	ConversationID *uint                `json:"conversation_id,omitempty"`
+	Reply          string               `json:"reply"`
+	Usage          ai.Usage             `json:"usage"`
+	Actions        []AIAction           `json:"actions"`
+	Plan           *database.ActionPlan `json:"plan,omitempty"`
+	Error          string               `json:"error,omitempty"`
+}
+
+// recurrenceHelp describes the recurrence patterns tasks accept
+const recurrenceHelp = "daily, weekly, weekdays like mon or mon,thu, a day of the month like 15, or a day and month like 15 jan. Needs a due_date."
+
+// commandTask is the compact form of a task shown to the model
+type commandTask struct {
+	ID          uint     `json:"id"`
+	Description string   `json:"description"`
+	Project     string   `json:"project"`
+	DueDate     string   `json:"due_date,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	Completed   bool     `json:"completed"`
+}
+
+// commandSession runs the tools of one command and keeps the log of what they did.
+// Tasks it creates are linked to audioID when the command came from a recording, and
+// the command is saved to conversation when it continues one. usage counts tokens
+// spent besides the agent's run, on summarizing the conversation. The agent runs
+// tools in parallel, so the logs are guarded by mu.
+type commandSession struct {
+	r            *http.Request
+	audioID      *uint
+	conversation *database.Conversation
+	usage        ai.Usage
+	mu           sync.Mutex
+	actions      []AIAction
+	created      []database.Task
+}
+
+// runAICommand lets the agent carry out a typed or spoken command with tools backed
+// by the database. The response lists every tool call, also when the agent fails
+// half way, so clients can show what was changed.
+func runAICommand(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Running AI command").Send()
+
+	if aiProvider == nil {
+		logger.Error("AI commands are not configured").Send()
+		http.Error(w, "AI commands are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req AICommandRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode AI command request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" {
+		http.Error(w, "text is required", http.StatusBadRequest)
+		return
+	}
+
+	agentContext, err := commandContext()
+	if err != nil {
+		logger.Error("Failed to build AI command context").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session := &commandSession{r: r}
+	agent := newCommandAgent(agentContext, commandPrompt, session.tools())
+	ctx, cancel := commandDeadline(r)
+	defer cancel()
+	executeAICommand(ctx, w, r, agent, session, req)
+}
+
+// executeAICommand runs the agent and responds with what it did. With ?stream=true or
+// Accept: text/event-stream the progress is streamed as server-sent events: "token"
+// for reply text as the model writes it, "tool_start" and "tool_finish" for each tool
+// call, "tool_pending" for each call held for approval, and finally "done" with the
+// whole response. The stream has already started when the run fails, so the error
+// is in "done". Held calls are saved as a plan, and commands in a conversation are
+// saved to it, also when the agent stops early. The run ends when ctx is done.
+func executeAICommand(ctx context.Context, w http.ResponseWriter, r *http.Request, agent *ai.Agent, session *commandSession, req AICommandRequest) {
+	text := req.Text
+	agent.SetDryRun(req.DryRun)
+
+	var stream *sseWriter
+	if wantsEventStream(r) {
+		var err error
+		stream, err = newSSEWriter(w)
+		if err != nil {
+			logger.Error("Failed to start event stream").Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		agent.OnEvent(func(event ai.Event) {
+			if err := stream.send(event.Type, event); err != nil {
+				logger.Warn("Failed to send AI command event").Str("event", event.Type).Err(err).Send()
+			}
+		})
+	}
+
+	result, err := agent.Execute(ctx, text)
+
+	response := session.response(result)
+	status := http.StatusOK
+	if err != nil {
+		logger.Error("AI command failed").Str("text", text).Int("actions", len(response.Actions)).Err(err).Send()
+		response.Error = err.Error()
+		status = agentErrorStatus(err)
+	}
+	if len(result.Pending) > 0 {
+		plan := database.ActionPlan{
+			Command:        text,
+			Reply:          result.Reply,
+			DryRun:         req.DryRun,
+			Calls:          toStoredToolCalls(result.Pending),
+			ConversationID: response.ConversationID,
+		}
+		if saveErr := database.DB.Create(&plan).Error; saveErr != nil {
+			logger.Error("Failed to save action plan").Int("calls", len(plan.Calls)).Err(saveErr).Send()
+			if err == nil {
+				err = saveErr
+				response.Error = saveErr.Error()
+				status = http.StatusInternalServerError
+			}
+		} else {
+			logger.Info("Saved action plan").Uint("plan_id", plan.ID).Int("calls", len(plan.Calls)).Send()
+			response.Plan = &plan
+		}
+	}
+	if session.conversation != nil {
+		saveErr := database.AppendConversation(database.DB, session.conversation, toConversationMessages(result.Messages), response.Usage.TotalTokens)
+		if saveErr != nil {
+			logger.Error("Failed to save conversation").Uint("conversation_id", session.conversation.ID).Err(saveErr).Send()
+			if err == nil {
+				err = saveErr
+				response.Error = saveErr.Error()
+				status = http.StatusInternalServerError
+			}
+		}
+	}
+	if err == nil {
+		logger.Info("Successfully ran AI command").Str("text", text).Int("actions", len(response.Actions)).Int("tokens", response.Usage.TotalTokens).Send()
+	}
+
+	if stream != nil {
+		if err := stream.send("done", response); err != nil {
+			logger.Warn("Failed to send AI command response").Err(err).Send()
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// response reports a run with the actions the session took
+func (s *commandSession) response(result ai.Result) AICommandResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response := AICommandResponse{Reply: result.Reply, Usage: result.Usage.Add(s.usage), Actions: s.actions}
+	if response.Actions == nil {
+		response.Actions = []AIAction{}
+	}
+	if s.conversation != nil {
+		response.ConversationID = &s.conversation.ID
+	}
+	return response
+}
+
+// newCommandAgent sets up an agent with the configured provider, token budget and
+// bulk write limit
+func newCommandAgent(agentContext, prompt string, tools []ai.Tool) *ai.Agent {
+	agent := ai.NewAgent(aiProvider, agentContext, prompt, tools)
+	agent.SetTokenBudget(appEnv.AITokenBudget)
+	agent.SetWriteLimit(appEnv.AIBulkWriteLimit)
+	return agent
+}
+
+// commandDeadline bounds an agent run by the AI timeout and the client connection
+func commandDeadline(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), time.Duration(appEnv.AITimeoutSeconds)*time.Second)
+}
+
+// agentErrorStatus maps why an agent run stopped to a response status
+func agentErrorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// newAIProvider picks the model provider from the environment, or nil when AI
+// commands aren't configured
+func newAIProvider(e *env.Env) ai.Provider {
+	switch {
+	case e.AIBaseURL != "":
+		return ai.NewOpenAICompatibleProvider(e.AIBaseURL, e.AIAPIKey, e.AIModel)
+	case e.OpenRouterAPIKey != "":
+		return ai.NewOpenRouterProvider(e.OpenRouterAPIKey, e.AIModel)
+	}
+	return nil
+}
+
+// commandContext tells the model today's date and the projects it can use
+func commandContext() (string, error) {
+	var projects []string
+	err := database.DB.Model(&database.Project{}).Scopes(database.ActiveProjects).Order(`"order", id`).Pluck("name", &projects).Error
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return fmt.Sprintf("Today is %s, %s. Projects: %s.", now.Weekday(), now.Format(time.DateOnly), strings.Join(projects, ", ")), nil
+}
+
+func (s *commandSession) tools() []ai.Tool {
+	return []ai.Tool{
+		additive(s.tool("create_task", "Create a task", map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"description": map[string]any{"type": "string"},
+				"project":     map[string]any{"type": "string", "description": "Project name, the Inbox when left out"},
+				"due_date":    map[string]any{"type": "string", "description": "YYYY-MM-DD"},
+				"recurrence":  map[string]any{"type": "string", "description": recurrenceHelp},
+				"labels":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+			"required": []string{"description"},
+		}, s.createTask)),
+		readOnly(s.tool("list_tasks", "List open tasks, optionally filtered", map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"project":           map[string]any{"type": "string"},
+				"label":             map[string]any{"type": "string"},
+				"text":              map[string]any{"type": "string", "description": "Text the description contains"},
+				"due_before":        map[string]any{"type": "string", "description": "YYYY-MM-DD, inclusive"},
+				"include_completed": map[string]any{"type": "boolean"},
+			},
+		}, s.listTasks)),
+		s.tool("complete_task", "Mark a task as done", map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"task_id": map[string]any{"type": "integer"},
+			},
+			"required": []string{"task_id"},
+		}, s.completeTask),
+		s.tool("move_task", "Move a task to another project and/or due date", map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"task_id":  map[string]any{"type": "integer"},
+				"project":  map[string]any{"type": "string"},
+				"due_date": map[string]any{"type": "string", "description": "YYYY-MM-DD, or an empty string to clear it"},
+			},
+			"required": []string{"task_id"},
+		}, s.moveTask),
+		needsConfirmation(s.tool("delete_task", "Move a task to the trash. The user must approve it.", map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"task_id": map[string]any{"type": "integer"},
+			},
+			"required": []string{"task_id"},
+		}, s.deleteTask)),
+		additive(s.tool("create_note", "Create a Markdown note", map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"title":   map[string]any{"type": "string"},
+				"content": map[string]any{"type": "string"},
+			},
+			"required": []string{"title"},
+		}, s.createNote)),
+		readOnly(s.tool("search", "Full-text search over tasks, notes and voice transcripts", map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"query": map[string]any{"type": "string"},
+				"types": map[string]any{"type": "array", "items": map[string]any{"type": "string", "enum": database.SearchTypes}},
+			},
+			"required": []string{"query"},
+		}, s.search)),
+	}
+}
+
+// readOnly marks a tool that changes nothing, so it also runs in dry runs
+func readOnly(tool ai.Tool) ai.Tool {
+	tool.ReadOnly = true
+	return tool
+}
+
+// additive marks a tool that only adds data, which doesn't count as a bulk change
+func additive(tool ai.Tool) ai.Tool {
+	tool.Additive = true
+	return tool
+}
+
+// needsConfirmation marks a tool whose calls wait for the user's approval
+func needsConfirmation(tool ai.Tool) ai.Tool {
+	tool.RequiresConfirmation = true
+	return tool
+}
+
+// tool wraps fn so its result is returned to the model as JSON and logged as an action
+func (s *commandSession) tool(name, description string, parameters map[string]any, fn func(ctx context.Context, args map[string]any) (any, error)) ai.Tool {
+	return ai.Tool{
+		Name:        name,
+		Description: description,
+		Parameters:  parameters,
+		Function: func(ctx context.Context, args map[string]any) (string, error) {
+			action := AIAction{Tool: name, Arguments: args}
+			result, err := fn(ctx, args)
+			if err == nil {
+				action.Result, err = json.Marshal(result)
+			}
+			if err != nil {
+				action.Error = err.Error()
+			}
+			s.mu.Lock()
+			s.actions = append(s.actions, action)
+			s.mu.Unlock()
+			return string(action.Result), err
+		},
+	}
+}
+
+func (s *commandSession) createTask(ctx context.Context, args map[string]any) (any, error) {
+	db := database.DB.WithContext(ctx)
+	description, _ := args["description"].(string)
+	if strings.TrimSpace(description) == "" {
+		return nil, fmt.Errorf("description is required")
+	}
+	t := database.Task{Description: description, Labels: stringList(args["labels"]), AudioID: s.audioID}
+	t.Recurrence, _ = args["recurrence"].(string)
+
+	if name, ok := args["project"].(string); ok && name != "" {
+		project, err := findProject(db, name)
+		if err != nil {
+			return nil, err
+		}
+		t.ProjectID = &project.ID
+	}
+	if due, ok := args["due_date"].(string); ok && due != "" {
+		date, err := time.Parse(time.DateOnly, due)
+		if err != nil {
+			return nil, fmt.Errorf("invalid due_date %q", due)
+		}
+		t.DueDate = &date
+	}
+
+	if err := saveNewTask(db, &t); err != nil {
+		return nil, err
+	}
+	recordActivity(s.r, database.ActivityEntityTask, t.ID, database.ActivityCreate, nil, t)
+	if err := db.Preload("Project").Where("id = ?", t.ID).First(&t).Error; err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.created = append(s.created, t)
+	s.mu.Unlock()
+	logger.Info("AI created task").Uint("task_id", t.ID).Send()
+	return toCommandTask(t), nil
+}
+
+func (s *commandSession) listTasks(ctx context.Context, args map[string]any) (any, error) {
+	db := database.DB.WithContext(ctx)
+	query := db.Preload("Project").Scopes(database.TasksInActiveProjects).Order("due_date NULLS LAST, id").Limit(maxCommandTasks)
+	if completed, _ := args["include_completed"].(bool); !completed {
+		query = query.Where("completed_at IS NULL")
+	}
+	if name, ok := args["project"].(string); ok && name != "" {
+		project, err := findProject(db, name)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("project_id = ?", project.ID)
+	}
+	if label, ok := args["label"].(string); ok && label != "" {
+		query = query.Where("? = ANY(labels)", label)
+	}
+	if text, ok := args["text"].(string); ok && text != "" {
+		query = query.Where("description ILIKE ?", "%"+text+"%")
+	}
+	if due, ok := args["due_before"].(string); ok && due != "" {
+		date, err := time.Parse(time.DateOnly, due)
+		if err != nil {
+			return nil, fmt.Errorf("invalid due_before %q", due)
+		}
+		query = query.Where("COALESCE(due_datetime, due_date) < ?", date.AddDate(0, 0, 1))
+	}
+
+	var tasks []database.Task
+	if err := query.Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	result := make([]commandTask, 0, len(tasks))
+	for _, t := range tasks {
+		result = append(result, toCommandTask(t))
+	}
+	return result, nil
+}
+
+func (s *commandSession) completeTask(ctx context.Context, args map[string]any) (any, error) {
+	db := database.DB.WithContext(ctx)
+	task, err := commandTaskArg(db, args)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := markTaskComplete(db, task); err != nil {
+		return nil, err
+	}
+	fresh := database.Task{}
+	recordUpdate(s.r, database.ActivityEntityTask, task.ID, database.ActivityComplete, task, &fresh)
+	logger.Info("AI completed task").Uint("task_id", task.ID).Send()
+	return map[string]any{"completed": task.ID}, nil
+}
+
+func (s *commandSession) moveTask(ctx context.Context, args map[string]any) (any, error) {
+	db := database.DB.WithContext(ctx)
+	task, err := commandTaskArg(db, args)
+	if err != nil {
+		return nil, err
+	}
+	// Tasks of archived projects are frozen
+	if task.ProjectID != nil {
+		if archived, err := isProjectArchived(db, *task.ProjectID); err != nil {
+			return nil, err
+		} else if archived {
+			return nil, errProjectArchived
+		}
+	}
+
+	updates := map[string]any{}
+	if name, ok := args["project"].(string); ok && name != "" {
+		project, err := findProject(db, name)
+		if err != nil {
+			return nil, err
+		}
+		if project.ArchivedAt != nil {
+			return nil, errProjectArchived
+		}
+		if task.ProjectID == nil || *task.ProjectID != project.ID {
+			var maxOrder int
+			db.Model(&database.Task{}).Select(`COALESCE(MAX("order"), 0)`).Where("project_id = ?", project.ID).Scan(&maxOrder)
+			updates["project_id"] = project.ID
+			updates["order"] = maxOrder + 1
+		}
+	}
+	if due, ok := args["due_date"].(string); ok {
+		var dueDate *time.Time
+		if due != "" {
+			date, err := time.Parse(time.DateOnly, due)
+			if err != nil {
+				return nil, fmt.Errorf("invalid due_date %q", due)
+			}
+			dueDate = &date
+		}
+		// A new due day replaces the due time as well, and recurring tasks keep one
+		if err := utils.ValidateTaskRecurrence(task.Recurrence, dueDate, nil); err != nil {
+			return nil, err
+		}
+		updates["due_date"] = dueDate
+		updates["due_datetime"] = nil
+	}
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("project or due_date is required")
+	}
+
+	if err := db.Model(&database.Task{}).Where("id = ?", task.ID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	var fresh database.Task
+	recordUpdate(s.r, database.ActivityEntityTask, task.ID, database.ActivityUpdate, task, &fresh)
+	if err := db.Preload("Project").Where("id = ?", task.ID).First(&fresh).Error; err != nil {
+		return nil, err
+	}
+	logger.Info("AI moved task").Uint("task_id", task.ID).Send()
+	return toCommandTask(fresh), nil
+}
+
+func (s *commandSession) deleteTask(ctx context.Context, args map[string]any) (any, error) {
+	db := database.DB.WithContext(ctx)
+	task, err := commandTaskArg(db, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Delete(&database.Task{}, task.ID).Error; err != nil {
+		return nil, err
+	}
+	recordActivity(s.r, database.ActivityEntityTask, task.ID, database.ActivityDelete, task, nil)
+	logger.Info("AI deleted task").Uint("task_id", task.ID).Send()
+	return map[string]any{"deleted": task.ID}, nil
+}
+
+func (s *commandSession) createNote(ctx context.Context, args map[string]any) (any, error) {
+	db := database.DB.WithContext(ctx)
+	title, _ := args["title"].(string)
+	if strings.TrimSpace(title) == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	content, _ := args["content"].(string)
+
+	note := database.Note{Title: title, Content: content, Tags: database.NormalizeTags(nil)}
+	if err := db.Create(&note).Error; err != nil {
+		return nil, err
+	}
+	recordActivity(s.r, database.ActivityEntityNote, note.ID, database.ActivityCreate, nil, note)
+	logger.Info("AI created note").Uint("note_id", note.ID).Send()
+	return map[string]any{"id": note.ID, "title": note.Title}, nil
+}
+
+func (s *commandSession) search(ctx context.Context, args map[string]any) (any, error) {
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	return database.Search(database.DB.WithContext(ctx), database.SearchQuery{
+		Query: query,
+		Types: stringList(args["types"]),
+		Limit: defaultSearchLimit,
+	})
+}
+
+// findProject looks up a project by name, ignoring case
+func findProject(db *gorm.DB, name string) (database.Project, error) {
+	var project database.Project
+	err := db.Where("LOWER(name) = LOWER(?)", strings.TrimSpace(name)).Order("archived_at NULLS FIRST, id").First(&project).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return project, fmt.Errorf("project %q not found", name)
+	}
+	return project, err
+}
+
+// commandTaskArg loads the task named by the task_id argument
+func commandTaskArg(db *gorm.DB, args map[string]any) (database.Task, error) {
+	var task database.Task
+	id, ok := args["task_id"].(float64)
+	if !ok || id <= 0 {
+		return task, fmt.Errorf("task_id is required")
+	}
+	err := db.Where("id = ?", uint(id)).First(&task).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return task, fmt.Errorf("task %d not found", uint(id))
+	}
+	return task, err
+}
+
+// stringList converts a JSON array argument to strings, skipping other values
+func stringList(value any) []string {
+	items, _ := value.([]any)
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func toCommandTask(t database.Task) commandTask {
+	ct := commandTask{
+		ID:          t.ID,
+		Description: t.Description,
+		Labels:      t.Labels,
+		Completed:   t.CompletedAt != nil,
+	}
+	if t.Project != nil {
+		ct.Project = t.Project.Name
+	}
+	if due := t.CurrentDue(); due != nil {
+		ct.DueDate = due.Format(time.DateOnly)
+	}
+	return ct
+}
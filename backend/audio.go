@@ -54,6 +54,13 @@ func transcribeAudio(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Handle multipart form data (frontend)
+	mode, parser := r.URL.Query().Get("mode"), r.URL.Query().Get("parser")
+	if err := validateAudioMode(mode, parser); err != nil {
+		logger.Error("Invalid audio mode").Str("mode", mode).Str("parser", parser).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	err := r.ParseMultipartForm(32 << 20) // 32MB max
 	if err != nil {
 		logger.Error("Failed to parse multipart form").Err(err).Send()
@@ -124,6 +131,16 @@ func transcribeAudio(w http.ResponseWriter, r *http.Request) {
 
 	logger.Info("Successfully transcribed audio").Str("text", result.Text).Send()
 
+	// Keep the transcript with the recording so it can be searched
+	if err := database.DB.Model(&audio).Update("transcript", result.Text).Error; err != nil {
+		logger.Warn("Failed to save transcript").Uint("audio_id", audio.ID).Err(err).Send()
+	}
+
+	if mode == audioModeTasks {
+		createVoiceTasks(w, r, audio, result.Text, parser)
+		return
+	}
+
 	// Create a new note with the transcribed text and audio reference
 	note := database.Note{
 		Title:   result.Text,
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+)
+
+type CommentRequest struct {
+	Content string `json:"content"`
+	NoteID  *uint  `json:"note_id"`
+	AudioID *uint  `json:"audio_id"`
+}
+
+func listTaskComments(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Listing task comments").Uint("task_id", id).Send()
+
+	if !taskExists(w, id) {
+		return
+	}
+	listComments(w, "task_id", id)
+}
+
+func createTaskComment(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Adding task comment").Uint("task_id", id).Send()
+
+	if !taskExists(w, id) {
+		return
+	}
+	createComment(w, r, database.Comment{TaskID: &id})
+}
+
+func listProjectComments(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseProjectID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Listing project comments").Uint("project_id", id).Send()
+
+	if !projectExists(w, id) {
+		return
+	}
+	listComments(w, "project_id", id)
+}
+
+func createProjectComment(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseProjectID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Adding project comment").Uint("project_id", id).Send()
+
+	if !projectExists(w, id) {
+		return
+	}
+	createComment(w, r, database.Comment{ProjectID: &id})
+}
+
+func updateComment(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseIDFromURL(r, w, "commentID")
+	if !ok {
+		return
+	}
+	logger.Info("Updating comment").Uint("comment_id", id).Send()
+
+	var req CommentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode comment request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var comment database.Comment
+	result := database.DB.Where("id = ?", id).First(&comment)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			logger.Error("Comment not found").Uint("comment_id", id).Send()
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to fetch comment").Uint("comment_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comment.Content = req.Content
+	comment.NoteID = req.NoteID
+	comment.AudioID = req.AudioID
+	if err := database.ValidateComment(database.DB, &comment); err != nil {
+		logger.Error("Invalid comment").Uint("comment_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result = database.DB.Model(&comment).Select("content", "note_id", "audio_id").Updates(&comment)
+	if result.Error != nil {
+		logger.Error("Failed to update comment").Uint("comment_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully updated comment").Uint("comment_id", id).Send()
+	json.NewEncoder(w).Encode(comment)
+}
+
+func deleteComment(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Deleting comment").Send()
+
+	id, ok := utils.ParseIDFromURL(r, w, "commentID")
+	if !ok {
+		return
+	}
+
+	result := database.DB.Delete(&database.Comment{}, id)
+	if result.Error != nil {
+		logger.Error("Failed to delete comment").Uint("comment_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully deleted comment").Uint("comment_id", id).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+// listComments writes the comments whose column matches id, oldest first
+func listComments(w http.ResponseWriter, column string, id uint) {
+	var comments []database.Comment
+	result := database.DB.Where(column+" = ?", id).Order("created_at, id").Find(&comments)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve comments").Uint(column, id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully retrieved comments").Uint(column, id).Int64("count", result.RowsAffected).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+// createComment decodes the request body into a comment attached to the given target
+func createComment(w http.ResponseWriter, r *http.Request, comment database.Comment) {
+	var req CommentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode comment request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comment.Content = req.Content
+	comment.NoteID = req.NoteID
+	comment.AudioID = req.AudioID
+	if err := database.ValidateComment(database.DB, &comment); err != nil {
+		logger.Error("Invalid comment").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := database.DB.Create(&comment)
+	if result.Error != nil {
+		logger.Error("Failed to create comment").Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully created comment").Uint("comment_id", comment.ID).Send()
+	json.NewEncoder(w).Encode(comment)
+}
+
+// projectExists writes a 404 response and returns false if the project doesn't exist
+func projectExists(w http.ResponseWriter, id uint) bool {
+	var count int64
+	if err := database.DB.Model(&database.Project{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		logger.Error("Failed to fetch project").Uint("project_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if count == 0 {
+		logger.Error("Project not found").Uint("project_id", id).Send()
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
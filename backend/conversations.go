@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/dima-b/go-task-backend/ai"
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+)
+
+// maxRelevantItems caps the tasks and notes matching a message that the agent is told about
+const maxRelevantItems = 5
+
+// maxRelevantWords caps the words of a message used to look up relevant items
+const maxRelevantWords = 20
+
+type ConversationRequest struct {
+	Title string `json:"title"`
+}
+
+// listConversations returns the conversations without their messages, most recent first
+func listConversations(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing conversations").Send()
+
+	var conversations []database.Conversation
+	result := database.DB.Order("updated_at DESC, id DESC").Find(&conversations)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve conversations").Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully retrieved conversations").Int64("count", result.RowsAffected).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversations)
+}
+
+// createConversation starts an empty conversation. Without a title it's named after
+// its first message.
+func createConversation(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Creating conversation").Send()
+
+	var req ConversationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode conversation request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conversation := database.Conversation{Title: strings.TrimSpace(req.Title)}
+	if err := database.DB.Create(&conversation).Error; err != nil {
+		logger.Error("Failed to create conversation").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully created conversation").Uint("conversation_id", conversation.ID).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversation)
+}
+
+// getConversation returns a conversation with all its messages, summarized ones included
+func getConversation(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseIDFromURL(r, w, "conversationID")
+	if !ok {
+		return
+	}
+	logger.Info("Getting conversation").Uint("conversation_id", id).Send()
+
+	var conversation database.Conversation
+	if !loadEntity(w, &conversation, id, "Conversation") {
+		return
+	}
+	err := database.DB.Where("conversation_id = ?", id).Order("id").Find(&conversation.Messages).Error
+	if err != nil {
+		logger.Error("Failed to retrieve conversation messages").Uint("conversation_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if conversation.Messages == nil {
+		conversation.Messages = []database.ConversationMessage{}
+	}
+
+	logger.Info("Successfully retrieved conversation").Uint("conversation_id", id).Int("messages", len(conversation.Messages)).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversation)
+}
+
+func updateConversation(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseIDFromURL(r, w, "conversationID")
+	if !ok {
+		return
+	}
+	logger.Info("Updating conversation").Uint("conversation_id", id).Send()
+
+	var req ConversationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode conversation request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := database.DB.Model(&database.Conversation{}).Where("id = ?", id).Update("title", strings.TrimSpace(req.Title))
+	if result.Error != nil {
+		logger.Error("Failed to update conversation").Uint("conversation_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		logger.Error("Conversation not found").Uint("conversation_id", id).Send()
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("Successfully updated conversation").Uint("conversation_id", id).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+func deleteConversation(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseIDFromURL(r, w, "conversationID")
+	if !ok {
+		return
+	}
+	logger.Info("Deleting conversation").Uint("conversation_id", id).Send()
+
+	// Messages are deleted with the conversation
+	result := database.DB.Delete(&database.Conversation{}, id)
+	if result.Error != nil {
+		logger.Error("Failed to delete conversation").Uint("conversation_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		logger.Error("Conversation not found").Uint("conversation_id", id).Send()
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("Successfully deleted conversation").Uint("conversation_id", id).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+// sendConversationMessage continues a conversation with a command. The agent gets
+// the conversation's history, with the older part summarized once it outgrows
+// AI_HISTORY_TOKENS, and is told about tasks and notes matching the message. It
+// responds like /ai/command, streaming included. Summarizing shares the command's
+// time limit and token budget.
+func sendConversationMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseIDFromURL(r, w, "conversationID")
+	if !ok {
+		return
+	}
+	logger.Info("Sending conversation message").Uint("conversation_id", id).Send()
+
+	if aiProvider == nil {
+		logger.Error("AI commands are not configured").Send()
+		http.Error(w, "AI commands are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var conversation database.Conversation
+	if !loadEntity(w, &conversation, id, "Conversation") {
+		return
+	}
+
+	var req AICommandRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode AI command request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" {
+		http.Error(w, "text is required", http.StatusBadRequest)
+		return
+	}
+
+	agentContext, err := commandContext()
+	if err != nil {
+		logger.Error("Failed to build AI command context").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session := &commandSession{r: r, conversation: &conversation}
+	agent := newCommandAgent(agentContext, commandPrompt, session.tools())
+
+	ctx, cancel := commandDeadline(r)
+	defer cancel()
+	history, err := conversationHistory(ctx, session)
+	if err != nil {
+		logger.Error("Failed to load conversation history").Uint("conversation_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	agent.SetHistory(history)
+	agent.SetSpentTokens(session.usage.TotalTokens)
+	agent.SetContext(agentContext + conversationMemory(ctx, conversation.Summary, req.Text))
+
+	executeAICommand(ctx, w, r, agent, session, req)
+}
+
+// conversationHistory loads the messages of the session's conversation for the
+// model. When they exceed AI_HISTORY_TOKENS the older ones are folded into the
+// summary. If summarizing fails the whole history is sent this time, and
+// summarizing is tried again with the next message.
+func conversationHistory(ctx context.Context, session *commandSession) ([]ai.Message, error) {
+	conversation := session.conversation
+	stored, err := database.ConversationHistory(database.DB, conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+	messages := toAIMessages(stored)
+
+	older, recent := ai.SplitHistory(messages, appEnv.AIHistoryTokens)
+	if len(older) == 0 {
+		return messages, nil
+	}
+
+	logger.Info("Summarizing conversation").Uint("conversation_id", conversation.ID).Int("messages", len(older)).Send()
+	summary, usage, err := ai.Summarize(ctx, aiProvider, conversation.Summary, older)
+	session.usage = usage
+	if err != nil {
+		logger.Warn("Failed to summarize conversation").Uint("conversation_id", conversation.ID).Err(err).Send()
+		return messages, nil
+	}
+
+	if err := database.SummarizeConversation(database.DB, conversation.ID, stored[len(older)-1].ID, summary); err != nil {
+		return nil, err
+	}
+	conversation.Summary = summary
+	return recent, nil
+}
+
+// conversationMemory describes what the agent should remember besides the recent
+// messages: the summary of the conversation and the tasks and notes that match the
+// message
+func conversationMemory(ctx context.Context, summary, text string) string {
+	var memory strings.Builder
+	if summary != "" {
+		fmt.Fprintf(&memory, "\n\nEarlier in this conversation: %s", summary)
+	}
+
+	query := relevantQuery(text)
+	if query == "" {
+		return memory.String()
+	}
+	results, err := database.Search(database.DB.WithContext(ctx), database.SearchQuery{
+		Query: query,
+		Types: []string{database.SearchTypeTask, database.SearchTypeNote},
+		Limit: maxRelevantItems,
+	})
+	if err != nil {
+		logger.Warn("Failed to find relevant items").Err(err).Send()
+		return memory.String()
+	}
+	if len(results) > 0 {
+		memory.WriteString("\n\nPossibly relevant:")
+		for _, result := range results {
+			fmt.Fprintf(&memory, "\n- %s %d: %s", result.Type, result.ID, result.Title)
+		}
+	}
+	return memory.String()
+}
+
+// relevantQuery turns a message into a search matching any of its words, as
+// matching all of them would rarely find anything
+func relevantQuery(text string) string {
+	var words []string
+	seen := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) < 3 || word == "or" || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+		if len(words) == maxRelevantWords {
+			break
+		}
+	}
+	return strings.Join(words, " or ")
+}
+
+func toAIMessages(stored []database.ConversationMessage) []ai.Message {
+	messages := make([]ai.Message, 0, len(stored))
+	for _, m := range stored {
+		message := ai.Message{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, ai.ToolCall{ID: call.ID, Name: call.Name, Arguments: call.Arguments})
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func toConversationMessages(messages []ai.Message) []database.ConversationMessage {
+	stored := make([]database.ConversationMessage, 0, len(messages))
+	for _, m := range messages {
+		stored = append(stored, database.ConversationMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			ToolCalls:  toStoredToolCalls(m.ToolCalls),
+			ToolCallID: m.ToolCallID,
+		})
+	}
+	return stored
+}
+
+func toStoredToolCalls(calls []ai.ToolCall) database.ToolCalls {
+	var stored database.ToolCalls
+	for _, call := range calls {
+		stored = append(stored, database.ToolCall{ID: call.ID, Name: call.Name, Arguments: call.Arguments})
+	}
+	return stored
+}
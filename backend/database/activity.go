@@ -0,0 +1,152 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// Activity entity types
+const (
+	ActivityEntityTask    = "task"
+	ActivityEntityProject = "project"
+	ActivityEntityNote    = "note"
+)
+
+// Activity actions
+const (
+	ActivityCreate    = "create"
+	ActivityUpdate    = "update"
+	ActivityDelete    = "delete"
+	ActivityComplete  = "complete"
+	ActivityReorder   = "reorder"
+	ActivityArchive   = "archive"
+	ActivityUnarchive = "unarchive"
+	ActivityRestore   = "restore"
+)
+
+// ActivityMeta describes the request that made a change
+type ActivityMeta struct {
+	DeviceID   string
+	RequestID  string
+	RemoteAddr string
+	UserAgent  string
+}
+
+// ActivityQuery filters the activity log. Zero values match everything.
+type ActivityQuery struct {
+	EntityType string
+	EntityID   uint
+	DeviceID   string
+	Limit      int
+	Offset     int
+}
+
+// RecordActivity stores an audit entry for a change. before and after are any values
+// that marshal to JSON objects; pass nil for the side that doesn't exist. When both are
+// given only the fields that differ are kept, and nothing is stored if none do.
+func RecordActivity(db *gorm.DB, meta ActivityMeta, entityType string, entityID uint, action string, before, after any) error {
+	beforeObj, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	afterObj, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+	if beforeObj != nil && afterObj != nil {
+		beforeObj, afterObj = diffObjects(beforeObj, afterObj)
+		if len(beforeObj) == 0 && len(afterObj) == 0 {
+			return nil
+		}
+	}
+
+	activity := Activity{
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Before:     beforeObj,
+		After:      afterObj,
+		DeviceID:   meta.DeviceID,
+		RequestID:  meta.RequestID,
+		RemoteAddr: meta.RemoteAddr,
+		UserAgent:  meta.UserAgent,
+	}
+	return db.Create(&activity).Error
+}
+
+// ListActivities returns a page of matching activity, newest first, and the total count
+func ListActivities(db *gorm.DB, q ActivityQuery) ([]Activity, int64, error) {
+	query := db.Model(&Activity{})
+	if q.EntityType != "" {
+		query = query.Where("entity_type = ?", q.EntityType)
+	}
+	if q.EntityID != 0 {
+		query = query.Where("entity_id = ?", q.EntityID)
+	}
+	if q.DeviceID != "" {
+		query = query.Where("device_id = ?", q.DeviceID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var activities []Activity
+	err := query.Order("created_at DESC, id DESC").Limit(q.Limit).Offset(q.Offset).Find(&activities).Error
+	return activities, total, err
+}
+
+// snapshot converts a value to a flat JSON object. Nested objects such as preloaded
+// associations are dropped; they have their own history.
+func snapshot(value any) (JSONObject, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var obj JSONObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+
+	for key, v := range obj {
+		switch v := v.(type) {
+		case map[string]any:
+			delete(obj, key)
+		case []any:
+			if len(v) > 0 {
+				if _, nested := v[0].(map[string]any); nested {
+					delete(obj, key)
+				}
+			}
+		}
+	}
+	return obj, nil
+}
+
+// diffObjects keeps the fields whose values differ, ignoring the updated_at timestamp
+func diffObjects(before, after JSONObject) (JSONObject, JSONObject) {
+	changedBefore := JSONObject{}
+	changedAfter := JSONObject{}
+	for key, value := range after {
+		if key == "updated_at" {
+			continue
+		}
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, value) {
+			changedBefore[key] = before[key]
+			changedAfter[key] = value
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok && key != "updated_at" {
+			changedBefore[key] = value
+			changedAfter[key] = nil
+		}
+	}
+	return changedBefore, changedAfter
+}
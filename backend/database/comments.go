@@ -0,0 +1,40 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ValidateComment checks that a comment has content, belongs to exactly one task or
+// project, and that its linked note and audio recording exist
+func ValidateComment(db *gorm.DB, c *Comment) error {
+	c.Content = strings.TrimSpace(c.Content)
+	if c.Content == "" {
+		return fmt.Errorf("content is required")
+	}
+	if (c.TaskID == nil) == (c.ProjectID == nil) {
+		return fmt.Errorf("a comment belongs to either a task or a project")
+	}
+
+	if c.NoteID != nil {
+		var count int64
+		if err := db.Model(&Note{}).Where("id = ?", *c.NoteID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("note %d not found", *c.NoteID)
+		}
+	}
+	if c.AudioID != nil {
+		var count int64
+		if err := db.Model(&Audio{}).Where("id = ?", *c.AudioID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("audio %d not found", *c.AudioID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// ConversationHistory returns the messages of a conversation that aren't summarized
+// yet, oldest first
+func ConversationHistory(db *gorm.DB, conversationID uint) ([]ConversationMessage, error) {
+	var messages []ConversationMessage
+	err := db.Where("conversation_id = ? AND NOT summarized", conversationID).Order("id").Find(&messages).Error
+	return messages, err
+}
+
+// SummarizeConversation replaces the summary of a conversation and marks its messages
+// up to throughID as summarized
+func SummarizeConversation(db *gorm.DB, conversationID, throughID uint, summary string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&ConversationMessage{}).
+			Where("conversation_id = ? AND id <= ?", conversationID, throughID).
+			Update("summarized", true).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Conversation{ID: conversationID}).Update("summary", summary).Error
+	})
+}
+
+// AppendConversation adds the messages of a run to a conversation and counts the
+// tokens it used. A conversation without a title is named after its first message.
+func AppendConversation(db *gorm.DB, conversation *Conversation, messages []ConversationMessage, tokens int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range messages {
+			messages[i].ConversationID = conversation.ID
+		}
+		if len(messages) > 0 {
+			if err := tx.Create(&messages).Error; err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]any{"total_tokens": gorm.Expr("total_tokens + ?", tokens)}
+		if conversation.Title == "" && len(messages) > 0 {
+			conversation.Title = conversationTitle(messages[0].Content)
+			updates["title"] = conversation.Title
+		}
+		if err := tx.Model(conversation).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", conversation.ID).First(conversation).Error
+	})
+}
+
+// maxConversationTitle caps the length, in characters, of titles taken from a message
+const maxConversationTitle = 60
+
+func conversationTitle(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxConversationTitle {
+		return text
+	}
+	return string(runes[:maxConversationTitle-1]) + "…"
+}
@@ -9,6 +9,12 @@ import (
 
 var DB *gorm.DB
 
+// InboxProjectName is the name of the system project that collects unsorted tasks
+const InboxProjectName = "Inbox"
+
+// InboxProjectID is the ID of the system Inbox project, resolved by InitDB
+var InboxProjectID uint
+
 func InitDB(databaseURL string) error {
 
 	logger.Info("Connecting to database").Send()
@@ -43,26 +49,89 @@ func InitDB(databaseURL string) error {
 		logger.Info("Cleared cached database plans").Send()
 	}
 
+	// Detach tasks pointing at projects that no longer exist so the
+	// project foreign key can be enforced
+	if DB.Migrator().HasTable(&Task{}) && DB.Migrator().HasTable(&Project{}) {
+		result := DB.Exec("UPDATE tasks SET project_id = NULL WHERE project_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM projects WHERE projects.id = tasks.project_id)")
+		if result.Error != nil {
+			logger.Error("Failed to detach orphaned tasks").Err(result.Error).Send()
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			logger.Warn("Detached orphaned tasks").Int64("count", result.RowsAffected).Send()
+		}
+	}
+
 	// Auto-migrate the schema
 	logger.Info("Running database migrations").Send()
-	err = DB.AutoMigrate(&Project{}, &Task{}, &Note{}, &Audio{})
+	err = DB.AutoMigrate(&Project{}, &Task{}, &Folder{}, &Note{}, &NoteRevision{}, &Audio{}, &Comment{}, &Goal{}, &GoalCheckIn{}, &TaskCompletion{}, &TaskDependency{}, &NoteTask{}, &TimeEntry{}, &FocusSession{}, &Activity{}, &Conversation{}, &ConversationMessage{}, &ActionPlan{})
 	if err != nil {
 		logger.Error("Failed to run database migrations").Err(err).Send()
 		return err
 	}
 
+	// Only one timer may run at a time
+	err = DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_time_entries_running ON time_entries ((ended_at IS NULL)) WHERE ended_at IS NULL").Error
+	if err != nil {
+		logger.Error("Failed to create running timer index").Err(err).Send()
+		return err
+	}
+
+	// Only one focus session may be active at a time
+	err = DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_focus_sessions_active ON focus_sessions ((true)) WHERE state IN ('focus', 'break', 'paused')").Error
+	if err != nil {
+		logger.Error("Failed to create active focus session index").Err(err).Send()
+		return err
+	}
+
+	// Completions used to be known only from completed_at, so record one for tasks
+	// completed before task_completions existed to keep them in the statistics
+	result := DB.Exec(`INSERT INTO task_completions (task_id, occurred_on, completed_at, created_at)
+		SELECT id, completed_at::date, completed_at, NOW() FROM tasks
+		WHERE completed_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM task_completions c WHERE c.task_id = tasks.id)`)
+	if result.Error != nil {
+		logger.Error("Failed to backfill task completions").Err(result.Error).Send()
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		logger.Info("Backfilled task completions").Int64("count", result.RowsAffected).Send()
+	}
+
 	logger.Info("Database migrations completed successfully").Send()
 
 	// Ensure Inbox project exists
+	if err := ensureInboxProject(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ensureInboxProject finds or creates the system Inbox project and remembers its ID.
+// Older databases identified the Inbox by name only, so a project named "Inbox" is
+// adopted and flagged when no flagged project exists yet.
+func ensureInboxProject() error {
 	var inboxProject Project
-	result := DB.Where("name = ?", "Inbox").First(&inboxProject)
+	result := DB.Where("is_inbox = ?", true).First(&inboxProject)
+	if result.Error == gorm.ErrRecordNotFound {
+		result = DB.Where("name = ?", InboxProjectName).Order("id").First(&inboxProject)
+		if result.Error == nil {
+			logger.Info("Flagging existing Inbox project").Uint("project_id", inboxProject.ID).Send()
+			if err := DB.Model(&inboxProject).Update("is_inbox", true).Error; err != nil {
+				logger.Error("Failed to flag Inbox project").Err(err).Send()
+				return err
+			}
+		}
+	}
+
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			logger.Info("Creating default Inbox project").Send()
 			inboxProject = Project{
-				Name:  "Inbox",
-				Color: "gray",
-				Order: 1,
+				Name:    InboxProjectName,
+				Color:   "gray",
+				Order:   1,
+				IsInbox: true,
 			}
 			if err := DB.Create(&inboxProject).Error; err != nil {
 				logger.Error("Failed to create Inbox project").Err(err).Send()
@@ -77,5 +146,18 @@ func InitDB(databaseURL string) error {
 		logger.Info("Inbox project already exists").Send()
 	}
 
+	InboxProjectID = inboxProject.ID
+	logger.Info("Using Inbox project").Uint("project_id", InboxProjectID).Send()
+
+	// Tasks without a project belong to the Inbox
+	result = DB.Model(&Task{}).Where("project_id IS NULL").Update("project_id", InboxProjectID)
+	if result.Error != nil {
+		logger.Error("Failed to move unassigned tasks to Inbox").Err(result.Error).Send()
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		logger.Info("Moved unassigned tasks to Inbox").Int64("count", result.RowsAffected).Send()
+	}
+
 	return nil
 }
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrDependencyCycle is returned when a dependency would make a task wait on itself
+var ErrDependencyCycle = errors.New("task can't depend on itself or on a task that depends on it")
+
+// ErrRecurringPrerequisite is returned when a task would wait on a recurring task,
+// which never stays completed
+var ErrRecurringPrerequisite = errors.New("task can't depend on a recurring task")
+
+// ActionableTasks selects open tasks whose prerequisites are all completed or trashed
+func ActionableTasks(db *gorm.DB) *gorm.DB {
+	return db.Where("tasks.completed_at IS NULL").
+		Where("NOT EXISTS (SELECT 1 FROM task_dependencies d JOIN tasks p ON p.id = d.blocked_by_id WHERE d.task_id = tasks.id AND p.completed_at IS NULL AND p.deleted_at IS NULL)")
+}
+
+// ValidateDependency checks that making taskID wait on blockedByID doesn't create a
+// cycle, i.e. that blockedByID doesn't already depend on taskID, directly or not,
+// and that blockedByID isn't recurring
+func ValidateDependency(db *gorm.DB, taskID, blockedByID uint) error {
+	if taskID == blockedByID {
+		return ErrDependencyCycle
+	}
+
+	var recurrence string
+	if err := db.Model(&Task{}).Select("recurrence").Where("id = ?", blockedByID).Scan(&recurrence).Error; err != nil {
+		return err
+	}
+	if recurrence != "" {
+		return ErrRecurringPrerequisite
+	}
+
+	visited := map[uint]bool{blockedByID: true}
+	queue := []uint{blockedByID}
+	for len(queue) > 0 {
+		var next []uint
+		if err := db.Model(&TaskDependency{}).Where("task_id IN ?", queue).Pluck("blocked_by_id", &next).Error; err != nil {
+			return err
+		}
+
+		queue = queue[:0]
+		for _, id := range next {
+			if id == taskID {
+				return ErrDependencyCycle
+			}
+			if !visited[id] {
+				visited[id] = true
+				queue = append(queue, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// FillBlocked sets BlockedBy to the open, untrashed prerequisites of each task and
+// Blocked when there are any
+func FillBlocked(db *gorm.DB, tasks []Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+
+	var deps []TaskDependency
+	err := db.Joins("JOIN tasks p ON p.id = task_dependencies.blocked_by_id").
+		Where("task_dependencies.task_id IN ? AND p.completed_at IS NULL AND p.deleted_at IS NULL", ids).
+		Order("task_dependencies.created_at").
+		Find(&deps).Error
+	if err != nil {
+		return err
+	}
+
+	blockedBy := map[uint][]uint{}
+	for _, d := range deps {
+		blockedBy[d.TaskID] = append(blockedBy[d.TaskID], d.BlockedByID)
+	}
+	for i := range tasks {
+		tasks[i].BlockedBy = blockedBy[tasks[i].ID]
+		if tasks[i].BlockedBy == nil {
+			tasks[i].BlockedBy = []uint{}
+		}
+		tasks[i].Blocked = len(tasks[i].BlockedBy) > 0
+	}
+	return nil
+}
+
+// UnblockDependents touches the tasks waiting on a completed task so they show up in
+// the next sync, and returns their IDs. The dependencies stay: completed prerequisites
+// no longer block, and block again when they are reopened.
+func UnblockDependents(db *gorm.DB, id uint) ([]uint, error) {
+	var dependents []uint
+	if err := db.Model(&TaskDependency{}).Where("blocked_by_id = ?", id).Pluck("task_id", &dependents).Error; err != nil {
+		return nil, err
+	}
+	if len(dependents) == 0 {
+		return nil, nil
+	}
+
+	err := db.Model(&Task{}).Where("id IN ?", dependents).UpdateColumn("updated_at", time.Now()).Error
+	return dependents, err
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// longBreakEvery is how many focus rounds pass between long breaks
+const longBreakEvery = 4
+
+// ErrInvalidFocusTransition is returned when an action doesn't apply to the session's state
+var ErrInvalidFocusTransition = errors.New("action not allowed in the session's current state")
+
+// FocusInterval is a span of uninterrupted focus within a session
+type FocusInterval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ValidateFocusSession checks the timings of a new session
+func ValidateFocusSession(s *FocusSession) error {
+	if s.FocusMinutes <= 0 || s.BreakMinutes < 0 || s.LongBreakMinutes < 0 || s.Cycles <= 0 {
+		return fmt.Errorf("focus_minutes and cycles must be positive and breaks can't be negative")
+	}
+	return nil
+}
+
+// ActiveFocusSessions selects sessions that are running or paused
+func ActiveFocusSessions(db *gorm.DB) *gorm.DB {
+	return db.Where("state IN ?", []string{FocusStateFocus, FocusStateBreak, FocusStatePaused})
+}
+
+// IsActive reports whether the session is running or paused
+func (s *FocusSession) IsActive() bool {
+	return s.State == FocusStateFocus || s.State == FocusStateBreak || s.State == FocusStatePaused
+}
+
+// Start begins the first focus phase
+func (s *FocusSession) Start(now time.Time) {
+	s.StartedAt = now
+	s.CompletedCycles = 0
+	s.FocusedSeconds = 0
+	s.startPhase(FocusStateFocus, now, s.FocusMinutes)
+}
+
+// Advance moves the session through every phase that has ended by now: a finished
+// focus phase starts a break (a long one every few rounds) and a finished break starts
+// the next focus phase, until all cycles are done. Returns the focus time completed.
+func (s *FocusSession) Advance(now time.Time) []FocusInterval {
+	var intervals []FocusInterval
+	for (s.State == FocusStateFocus || s.State == FocusStateBreak) && s.PhaseEndsAt != nil && !now.Before(*s.PhaseEndsAt) {
+		end := *s.PhaseEndsAt
+		if s.State == FocusStateBreak {
+			s.startPhase(FocusStateFocus, end, s.FocusMinutes)
+			continue
+		}
+
+		intervals = append(intervals, s.closeFocus(end))
+		s.CompletedCycles++
+		if s.CompletedCycles >= s.Cycles {
+			s.finish(FocusStateCompleted, end)
+			break
+		}
+		breakMinutes := s.BreakMinutes
+		if s.CompletedCycles%longBreakEvery == 0 {
+			breakMinutes = s.LongBreakMinutes
+		}
+		s.startPhase(FocusStateBreak, end, breakMinutes)
+	}
+	return intervals
+}
+
+// Pause freezes the current phase, keeping its remaining time
+func (s *FocusSession) Pause(now time.Time) ([]FocusInterval, error) {
+	intervals := s.Advance(now)
+	if s.State != FocusStateFocus && s.State != FocusStateBreak {
+		return intervals, ErrInvalidFocusTransition
+	}
+
+	if s.State == FocusStateFocus {
+		intervals = append(intervals, s.closeFocus(now))
+	}
+	s.RemainingSeconds = int(s.PhaseEndsAt.Sub(now).Seconds())
+	s.PausedState = s.State
+	s.State = FocusStatePaused
+	s.PhaseEndsAt = nil
+	return intervals, nil
+}
+
+// Resume continues a paused phase with the time it had left
+func (s *FocusSession) Resume(now time.Time) error {
+	if s.State != FocusStatePaused {
+		return ErrInvalidFocusTransition
+	}
+
+	state := s.PausedState
+	if state == "" {
+		state = FocusStateFocus
+	}
+	s.PhaseStartedAt = now
+	ends := now.Add(time.Duration(s.RemainingSeconds) * time.Second)
+	s.PhaseEndsAt = &ends
+	s.State = state
+	s.PausedState = ""
+	s.RemainingSeconds = 0
+	return nil
+}
+
+// Abort ends the session early, keeping any focus time already spent
+func (s *FocusSession) Abort(now time.Time) ([]FocusInterval, error) {
+	intervals := s.Advance(now)
+	if !s.IsActive() {
+		return intervals, ErrInvalidFocusTransition
+	}
+
+	if s.State == FocusStateFocus && now.After(s.PhaseStartedAt) {
+		intervals = append(intervals, s.closeFocus(now))
+	}
+	s.finish(FocusStateAborted, now)
+	return intervals, nil
+}
+
+func (s *FocusSession) startPhase(state string, at time.Time, minutes int) {
+	ends := at.Add(time.Duration(minutes) * time.Minute)
+	s.State = state
+	s.PhaseStartedAt = at
+	s.PhaseEndsAt = &ends
+}
+
+func (s *FocusSession) closeFocus(end time.Time) FocusInterval {
+	interval := FocusInterval{Start: s.PhaseStartedAt, End: end}
+	s.FocusedSeconds += int(end.Sub(s.PhaseStartedAt).Seconds())
+	return interval
+}
+
+func (s *FocusSession) finish(state string, at time.Time) {
+	s.State = state
+	s.PausedState = ""
+	s.PhaseEndsAt = nil
+	s.RemainingSeconds = 0
+	s.EndedAt = &at
+}
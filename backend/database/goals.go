@@ -0,0 +1,197 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxForecast caps how far ahead a goal forecast is projected
+const maxForecast = 100 * 365 * 24 * time.Hour
+
+// GoalProgress is the computed state of a goal at a point in time
+type GoalProgress struct {
+	Current  float64    `json:"current"`
+	Target   float64    `json:"target"`
+	Percent  float64    `json:"percent"`
+	Achieved bool       `json:"achieved"`
+	Forecast *time.Time `json:"forecast"`
+	OnTrack  *bool      `json:"on_track"`
+}
+
+// ValidateGoal checks the metric configuration of a goal
+func ValidateGoal(g *Goal) error {
+	if g.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	switch g.MetricType {
+	case GoalMetricCount:
+		if g.TargetValue <= 0 {
+			return fmt.Errorf("target_value must be positive")
+		}
+	case GoalMetricNumeric:
+		if g.TargetValue == g.StartValue {
+			return fmt.Errorf("target_value must differ from start_value")
+		}
+	case GoalMetricBoolean:
+	default:
+		return fmt.Errorf("metric_type must be one of: count, numeric, boolean")
+	}
+	return nil
+}
+
+// PreloadGoal loads everything needed to compute goal progress
+func PreloadGoal(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("CheckIns", func(db *gorm.DB) *gorm.DB { return db.Order("checked_at") }).
+		Preload("Tasks").
+		Preload("Projects.Tasks")
+}
+
+// TouchGoalsForTask bumps goals linked to a task, directly or through its project,
+// so that clients re-sync their progress
+func TouchGoalsForTask(db *gorm.DB, task Task) error {
+	query := db.Model(&Goal{}).Where("id IN (SELECT goal_id FROM goal_tasks WHERE task_id = ?)", task.ID)
+	if task.ProjectID != nil {
+		query = query.Or("id IN (SELECT goal_id FROM goal_projects WHERE project_id = ?)", *task.ProjectID)
+	}
+	return query.Update("updated_at", time.Now()).Error
+}
+
+// ComputeProgress fills the link IDs and Progress of a goal loaded with PreloadGoal.
+//
+// Count goals add up check-in values and completed linked tasks. Numeric goals take
+// the latest check-in as the current value and measure it between StartValue and
+// TargetValue, so decreasing targets work too. Boolean goals are achieved by a
+// check-in or by completing every linked task.
+func (g *Goal) ComputeProgress(now time.Time) {
+	g.ProjectIDs = make([]uint, 0, len(g.Projects))
+	for _, p := range g.Projects {
+		g.ProjectIDs = append(g.ProjectIDs, p.ID)
+	}
+	g.TaskIDs = make([]uint, 0, len(g.Tasks))
+	for _, t := range g.Tasks {
+		g.TaskIDs = append(g.TaskIDs, t.ID)
+	}
+
+	linked, completed := g.linkedTaskCounts()
+	progress := &GoalProgress{Target: g.TargetValue}
+
+	switch g.MetricType {
+	case GoalMetricBoolean:
+		progress.Target = 1
+		for _, c := range g.CheckIns {
+			if c.Value > 0 {
+				progress.Achieved = true
+			}
+		}
+		if linked > 0 && completed == linked {
+			progress.Achieved = true
+		}
+		if progress.Achieved {
+			progress.Current = 1
+			progress.Percent = 100
+		} else if linked > 0 {
+			progress.Percent = float64(completed) / float64(linked) * 100
+		}
+	case GoalMetricNumeric:
+		progress.Current = g.StartValue
+		if len(g.CheckIns) > 0 {
+			progress.Current = g.CheckIns[len(g.CheckIns)-1].Value
+		}
+		progress.Percent = g.percentOf(progress.Current)
+		progress.Achieved = progress.Percent >= 100
+		progress.Forecast = g.forecast(progress.Current, now)
+	default:
+		for _, c := range g.CheckIns {
+			progress.Current += c.Value
+		}
+		progress.Current += float64(completed)
+		progress.Percent = g.percentOf(progress.Current)
+		progress.Achieved = progress.Percent >= 100
+		progress.Forecast = g.forecast(progress.Current, now)
+	}
+
+	if g.Deadline != nil {
+		onTrack := progress.Achieved || (progress.Forecast != nil && !progress.Forecast.After(*g.Deadline))
+		progress.OnTrack = &onTrack
+	}
+
+	g.Progress = progress
+}
+
+// linkedTaskCounts counts the distinct tasks linked directly or through projects
+func (g *Goal) linkedTaskCounts() (linked, completed int) {
+	seen := map[uint]bool{}
+	count := func(t Task) {
+		if seen[t.ID] {
+			return
+		}
+		seen[t.ID] = true
+		linked++
+		if t.CompletedAt != nil {
+			completed++
+		}
+	}
+	for _, t := range g.Tasks {
+		count(t)
+	}
+	for _, p := range g.Projects {
+		for _, t := range p.Tasks {
+			count(t)
+		}
+	}
+	return linked, completed
+}
+
+// baseline is the value progress is measured from; count goals always start at zero
+func (g *Goal) baseline() float64 {
+	if g.MetricType == GoalMetricNumeric {
+		return g.StartValue
+	}
+	return 0
+}
+
+func (g *Goal) percentOf(current float64) float64 {
+	span := g.TargetValue - g.baseline()
+	if span == 0 {
+		return 0
+	}
+	percent := (current - g.baseline()) / span * 100
+	return math.Max(0, math.Min(100, percent))
+}
+
+// forecast projects when the target will be reached at the average rate since the goal
+// was created. Returns nil when there is no progress to extrapolate from.
+func (g *Goal) forecast(current float64, now time.Time) *time.Time {
+	if g.percentOf(current) >= 100 {
+		return nil
+	}
+
+	start := g.CreatedAt
+	if len(g.CheckIns) > 0 && g.CheckIns[0].CheckedAt.Before(start) {
+		start = g.CheckIns[0].CheckedAt
+	}
+	elapsed := now.Sub(start)
+	if elapsed <= 0 {
+		return nil
+	}
+
+	done := current - g.baseline()
+	remaining := g.TargetValue - current
+	// No movement, or movement away from the target
+	if done == 0 || (done > 0) != (remaining > 0) {
+		return nil
+	}
+
+	rate := done / elapsed.Seconds()
+	seconds := remaining / rate
+	// Too far out to be a meaningful date
+	if seconds > maxForecast.Seconds() {
+		return nil
+	}
+	forecast := now.Add(time.Duration(seconds * float64(time.Second)))
+	return &forecast
+}
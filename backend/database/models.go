@@ -2,7 +2,10 @@ package database
 
 import (
 	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"github.com/lib/pq"
+	"gorm.io/gorm"
 	"time"
 )
 
@@ -39,43 +42,355 @@ func (ta *TimeArray) Scan(value interface{}) error {
 	return nil
 }
 
+// JSONObject is a custom type for storing JSON objects in jsonb columns
+type JSONObject map[string]any
+
+// Value implements driver.Valuer interface
+func (o JSONObject) Value() (driver.Value, error) {
+	if o == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner interface
+func (o *JSONObject) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	default:
+		return fmt.Errorf("unsupported JSON value of type %T", value)
+	}
+}
+
 type Task struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Description string         `gorm:"not null" json:"description"`
-	ProjectID   *uint          `gorm:"index" json:"project_id"`
-	Project     *Project       `gorm:"foreignKey:ProjectID" json:"project"`
-	DueDate     *time.Time     `json:"due_date"`
-	DueDatetime *time.Time     `json:"due_datetime"`
-	Labels      pq.StringArray `gorm:"type:text[]" json:"labels"`
-	Reminders   TimeArray      `gorm:"type:timestamp[]" json:"reminders"`
-	Recurrence  string         `json:"recurrence"`
-	Order       int            `gorm:"default:0" json:"order"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	CompletedAt *time.Time     `json:"completed_at"`
+	ID               uint             `gorm:"primaryKey" json:"id"`
+	Description      string           `gorm:"not null" json:"description"`
+	ProjectID        *uint            `gorm:"index" json:"project_id"`
+	Project          *Project         `gorm:"foreignKey:ProjectID" json:"project"`
+	DueDate          *time.Time       `json:"due_date"`
+	DueDatetime      *time.Time       `json:"due_datetime"`
+	Labels           pq.StringArray   `gorm:"type:text[]" json:"labels"`
+	Reminders        TimeArray        `gorm:"type:timestamp[]" json:"reminders"`
+	Recurrence       string           `json:"recurrence"`
+	IsHabit          bool             `gorm:"default:false" json:"is_habit"`
+	Order            int              `gorm:"default:0" json:"order"`
+	EstimatedMinutes *int             `json:"estimated_minutes"`
+	AudioID          *uint            `gorm:"index" json:"audio_id"`
+	Completions      []TaskCompletion `gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE" json:"-"`
+	TimeEntries      []TimeEntry      `gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE" json:"-"`
+	Dependencies     []TaskDependency `gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE" json:"-"`
+	Comments         []Comment        `gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE" json:"-"`
+	BlockedBy        []uint           `gorm:"-" json:"blocked_by"`
+	Blocked          bool             `gorm:"-" json:"blocked"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	CompletedAt      *time.Time       `json:"completed_at"`
+	DeletedAt        gorm.DeletedAt   `gorm:"index" json:"deleted_at"`
+}
+
+// TaskCompletion records each time a task was completed. For recurring tasks
+// OccurredOn is the date of the occurrence that was completed, which is what habit
+// statistics are computed from.
+type TaskCompletion struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TaskID      uint      `gorm:"not null;uniqueIndex:idx_task_completions_occurrence" json:"task_id"`
+	OccurredOn  time.Time `gorm:"type:date;not null;uniqueIndex:idx_task_completions_occurrence" json:"occurred_on"`
+	CompletedAt time.Time `gorm:"not null;index" json:"completed_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TaskDependency records that TaskID can't be started until BlockedByID is completed
+type TaskDependency struct {
+	TaskID      uint      `gorm:"primaryKey" json:"task_id"`
+	BlockedByID uint      `gorm:"primaryKey;index" json:"blocked_by_id"`
+	BlockedBy   *Task     `gorm:"foreignKey:BlockedByID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NoteTask links a note to a task, such as the action items taken from a voice note
+type NoteTask struct {
+	NoteID    uint      `gorm:"primaryKey" json:"note_id"`
+	TaskID    uint      `gorm:"primaryKey;index" json:"task_id"`
+	Task      *Task     `gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TimeEntry is a span of time spent on a task, either timed or logged manually.
+// A running timer has no EndedAt.
+type TimeEntry struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TaskID    uint       `gorm:"not null;index" json:"task_id"`
+	StartedAt time.Time  `gorm:"not null;index" json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Note      string     `json:"note"`
+	Manual    bool       `gorm:"default:false" json:"manual"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
 type Project struct {
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	Name            string         `gorm:"not null" json:"name"`
+	Color           string         `gorm:"default:'gray'" json:"color"`
+	Order           int            `gorm:"default:0" json:"order"`
+	IsInbox         bool           `gorm:"default:false" json:"is_inbox"`
+	ArchivedAt      *time.Time     `gorm:"index" json:"archived_at"`
+	ParentID        *uint          `gorm:"index" json:"parent_id"`
+	TrashedParentID *uint          `gorm:"index" json:"-"`
+	Children        []Project      `gorm:"foreignKey:ParentID;constraint:OnDelete:RESTRICT" json:"children,omitempty"`
+	Stats           *ProjectStats  `gorm:"-" json:"stats,omitempty"`
+	Tasks           []Task         `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"tasks"`
+	Comments        []Comment      `gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+type Note struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	Title     string         `gorm:"not null" json:"title"`
+	Content   string         `json:"content"`
+	Tags      pq.StringArray `gorm:"type:text[]" json:"tags"`
+	Pinned    bool           `gorm:"default:false;index" json:"pinned"`
+	FolderID  *uint          `gorm:"index" json:"folder_id"`
+	AudioID   *uint          `gorm:"index" json:"audio_id"`
+	TaskLinks []NoteTask     `gorm:"foreignKey:NoteID;constraint:OnDelete:CASCADE" json:"-"`
+	Revisions []NoteRevision `gorm:"foreignKey:NoteID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// NoteRevision is an earlier version of a note's title and content. EditedAt is when
+// the version was written, CreatedAt when it was replaced.
+type NoteRevision struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	NoteID    uint      `gorm:"not null;index" json:"note_id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	EditedAt  time.Time `json:"edited_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Folder groups notes like a notebook. Deleting a folder keeps its notes.
+type Folder struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Name      string    `gorm:"not null" json:"name"`
 	Color     string    `gorm:"default:'gray'" json:"color"`
 	Order     int       `gorm:"default:0" json:"order"`
-	Tasks     []Task    `gorm:"foreignKey:ProjectID" json:"tasks"`
+	Notes     []Note    `gorm:"foreignKey:FolderID;constraint:OnDelete:SET NULL" json:"-"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-type Note struct {
+type Audio struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Data       string    `gorm:"type:text;not null" json:"data"`
+	Transcript string    `gorm:"type:text" json:"transcript"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Comment is a progress note on either a task or a project. It may point to an existing
+// note or audio recording.
+type Comment struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Title     string    `gorm:"not null" json:"title"`
-	Content   string    `json:"content"`
+	TaskID    *uint     `gorm:"index" json:"task_id"`
+	ProjectID *uint     `gorm:"index" json:"project_id"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	NoteID    *uint     `gorm:"index" json:"note_id"`
+	Note      *Note     `gorm:"foreignKey:NoteID;constraint:OnDelete:SET NULL" json:"-"`
 	AudioID   *uint     `gorm:"index" json:"audio_id"`
+	Audio     *Audio    `gorm:"foreignKey:AudioID;constraint:OnDelete:SET NULL" json:"-"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-type Audio struct {
+// Goal metric types
+const (
+	GoalMetricCount   = "count"
+	GoalMetricNumeric = "numeric"
+	GoalMetricBoolean = "boolean"
+)
+
+type Goal struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	Title       string        `gorm:"not null" json:"title"`
+	Description string        `json:"description"`
+	MetricType  string        `gorm:"not null;default:'count'" json:"metric_type"`
+	StartValue  float64       `json:"start_value"`
+	TargetValue float64       `json:"target_value"`
+	Unit        string        `json:"unit"`
+	Deadline    *time.Time    `json:"deadline"`
+	Projects    []Project     `gorm:"many2many:goal_projects;constraint:OnDelete:CASCADE" json:"-"`
+	Tasks       []Task        `gorm:"many2many:goal_tasks;constraint:OnDelete:CASCADE" json:"-"`
+	ProjectIDs  []uint        `gorm:"-" json:"project_ids"`
+	TaskIDs     []uint        `gorm:"-" json:"task_ids"`
+	CheckIns    []GoalCheckIn `gorm:"foreignKey:GoalID;constraint:OnDelete:CASCADE" json:"check_ins"`
+	Progress    *GoalProgress `gorm:"-" json:"progress"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+type GoalCheckIn struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Data      string    `gorm:"type:text;not null" json:"data"`
+	GoalID    uint      `gorm:"not null;index" json:"goal_id"`
+	Value     float64   `json:"value"`
+	Note      string    `json:"note"`
+	CheckedAt time.Time `gorm:"not null" json:"checked_at"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// Activity is an audit log entry for a change made through the API. For updates Before
+// and After hold only the fields that changed; creates have no Before and deletes no After.
+type Activity struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	EntityType string     `gorm:"not null;index:idx_activities_entity" json:"entity_type"`
+	EntityID   uint       `gorm:"not null;index:idx_activities_entity" json:"entity_id"`
+	Action     string     `gorm:"not null" json:"action"`
+	Before     JSONObject `gorm:"type:jsonb" json:"before"`
+	After      JSONObject `gorm:"type:jsonb" json:"after"`
+	DeviceID   string     `gorm:"index" json:"device_id"`
+	RequestID  string     `json:"request_id"`
+	RemoteAddr string     `json:"remote_addr"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+}
+
+// Conversation is a chat with the AI agent. Summary condenses the messages marked
+// Summarized, which are kept for reading but no longer sent to the model.
+type Conversation struct {
+	ID          uint                  `gorm:"primaryKey" json:"id"`
+	Title       string                `json:"title"`
+	Summary     string                `gorm:"type:text" json:"summary"`
+	TotalTokens int                   `gorm:"default:0" json:"total_tokens"`
+	Messages    []ConversationMessage `gorm:"foreignKey:ConversationID;constraint:OnDelete:CASCADE" json:"messages,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `gorm:"index" json:"updated_at"`
+}
+
+// ConversationMessage is a message of a conversation: the user's input, the agent's
+// replies and tool calls, and the tool results answering ToolCallID
+type ConversationMessage struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	ConversationID uint      `gorm:"not null;index" json:"conversation_id"`
+	Role           string    `gorm:"not null" json:"role"`
+	Content        string    `gorm:"type:text" json:"content"`
+	ToolCalls      ToolCalls `gorm:"type:jsonb" json:"tool_calls,omitempty"`
+	ToolCallID     string    `json:"tool_call_id,omitempty"`
+	Summarized     bool      `gorm:"default:false" json:"summarized"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ToolCall is a tool call the agent made, with its JSON arguments. Calls of a plan
+// also record how they went once the plan is approved.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Done      bool   `json:"done,omitempty"`
+	Result    string `json:"result,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ToolCalls stores tool calls in a jsonb column
+type ToolCalls []ToolCall
+
+// Value implements driver.Valuer interface
+func (c ToolCalls) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner interface
+func (c *ToolCalls) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("unsupported JSON value of type %T", value)
+	}
+}
+
+// Action plan states. An approved plan is approving while its calls run, then
+// approved, or failed when some call failed. A failed plan can be approved again to
+// retry the calls that aren't done, or rejected. So can a plan left approving by a
+// run that died.
+const (
+	PlanStatusPending   = "pending"
+	PlanStatusApproving = "approving"
+	PlanStatusApproved  = "approved"
+	PlanStatusFailed    = "failed"
+	PlanStatusRejected  = "rejected"
+)
+
+// PlanStatuses lists every plan state
+var PlanStatuses = []string{PlanStatusPending, PlanStatusApproving, PlanStatusApproved, PlanStatusFailed, PlanStatusRejected}
+
+// ActionPlan holds the tool calls of an AI command that wait for the user's approval:
+// calls of tools that require confirmation, bulk changes, or every change of a dry
+// run. Nothing in Calls is done until the plan is approved.
+type ActionPlan struct {
+	ID             uint          `gorm:"primaryKey" json:"id"`
+	Status         string        `gorm:"not null;default:'pending';index" json:"status"`
+	Command        string        `gorm:"type:text" json:"command"`
+	Reply          string        `gorm:"type:text" json:"reply"`
+	DryRun         bool          `gorm:"default:false" json:"dry_run"`
+	Calls          ToolCalls     `gorm:"type:jsonb" json:"calls"`
+	ConversationID *uint         `gorm:"index" json:"conversation_id"`
+	Conversation   *Conversation `gorm:"foreignKey:ConversationID;constraint:OnDelete:CASCADE" json:"-"`
+	ResolvedAt     *time.Time    `json:"resolved_at"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// Focus session states. Focus and break phases follow each other automatically
+// until the planned cycles are done.
+const (
+	FocusStateFocus     = "focus"
+	FocusStateBreak     = "break"
+	FocusStatePaused    = "paused"
+	FocusStateCompleted = "completed"
+	FocusStateAborted   = "aborted"
+)
+
+type FocusSession struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	TaskID           *uint      `gorm:"index" json:"task_id"`
+	Task             *Task      `gorm:"foreignKey:TaskID;constraint:OnDelete:SET NULL" json:"-"`
+	State            string     `gorm:"not null;index" json:"state"`
+	PausedState      string     `json:"paused_state"`
+	FocusMinutes     int        `gorm:"not null" json:"focus_minutes"`
+	BreakMinutes     int        `gorm:"not null" json:"break_minutes"`
+	LongBreakMinutes int        `gorm:"not null" json:"long_break_minutes"`
+	Cycles           int        `gorm:"not null" json:"cycles"`
+	CompletedCycles  int        `gorm:"default:0" json:"completed_cycles"`
+	PhaseStartedAt   time.Time  `json:"phase_started_at"`
+	PhaseEndsAt      *time.Time `json:"phase_ends_at"`
+	RemainingSeconds int        `gorm:"default:0" json:"remaining_seconds"`
+	FocusedSeconds   int        `gorm:"default:0" json:"focused_seconds"`
+	StartedAt        time.Time  `json:"started_at"`
+	EndedAt          *time.Time `json:"ended_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dima-b/go-task-backend/markdown"
+	"github.com/lib/pq"
+)
+
+// excerptLength is the maximum length of a note excerpt in characters
+const excerptLength = 200
+
+// NoteSummary describes a note without its full content, for note lists
+type NoteSummary struct {
+	ID        uint               `json:"id"`
+	Title     string             `json:"title"`
+	Excerpt   string             `json:"excerpt"`
+	Headings  []markdown.Heading `json:"headings"`
+	Checklist markdown.Checklist `json:"checklist"`
+	Tags      pq.StringArray     `json:"tags"`
+	Pinned    bool               `json:"pinned"`
+	FolderID  *uint              `json:"folder_id"`
+	AudioID   *uint              `json:"audio_id"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// Summary renders the note's Markdown content into an excerpt and outline
+func (n Note) Summary() NoteSummary {
+	return NoteSummary{
+		ID:        n.ID,
+		Title:     n.Title,
+		Excerpt:   markdown.Excerpt(n.Content, excerptLength),
+		Headings:  markdown.Headings(n.Content),
+		Checklist: markdown.CountChecklist(n.Content),
+		Tags:      n.Tags,
+		Pinned:    n.Pinned,
+		FolderID:  n.FolderID,
+		AudioID:   n.AudioID,
+		CreatedAt: n.CreatedAt,
+		UpdatedAt: n.UpdatedAt,
+	}
+}
+
+// NormalizeTags trims tags, drops a leading '#' and removes empty and duplicate tags
+func NormalizeTags(tags []string) pq.StringArray {
+	normalized := pq.StringArray{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// ActionItem is a line of a note that can become a task
+type ActionItem struct {
+	Text string
+	Done bool
+}
+
+// ActionItems returns the checklist and bullet items of the note. A voice note
+// without content falls back to its transcript title as a single item.
+func (n Note) ActionItems() []ActionItem {
+	var items []ActionItem
+	for _, item := range markdown.ListItems(n.Content) {
+		items = append(items, ActionItem{Text: item.Text, Done: item.Done})
+	}
+	if len(items) == 0 && strings.TrimSpace(n.Content) == "" && n.AudioID != nil {
+		if title := strings.TrimSpace(n.Title); title != "" {
+			items = append(items, ActionItem{Text: title})
+		}
+	}
+	return items
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrPlanResolved is returned for a plan that isn't in a state the change starts from
+var ErrPlanResolved = errors.New("plan is already resolved")
+
+// TransitionPlan moves a plan to status from one of the from states. Only one caller
+// can make a transition, so a plan's calls don't run twice at the same time. An
+// approving plan last saved before staleBefore was left by a run that died, and
+// counts as failed. The returned plan has its state before the change when it fails
+// with ErrPlanResolved.
+func TransitionPlan(db *gorm.DB, id uint, status string, staleBefore time.Time, from ...string) (ActionPlan, error) {
+	var plan ActionPlan
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", id).First(&plan).Error; err != nil {
+			return err
+		}
+		current := plan.Status
+		if current == PlanStatusApproving && plan.UpdatedAt.Before(staleBefore) {
+			current = PlanStatusFailed
+		}
+		if !slices.Contains(from, current) {
+			return ErrPlanResolved
+		}
+
+		updates := map[string]any{"status": status}
+		if status == PlanStatusApproved || status == PlanStatusRejected {
+			now := time.Now()
+			updates["resolved_at"] = now
+			plan.ResolvedAt = &now
+		}
+		result := tx.Model(&ActionPlan{}).Where("id = ? AND status = ? AND updated_at = ?", id, plan.Status, plan.UpdatedAt).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPlanResolved
+		}
+		plan.Status = status
+		return nil
+	})
+	return plan, err
+}
+
+// SavePlanCalls saves the outcome of the plan's calls so far, so calls that ran
+// aren't run again when the approval is retried
+func SavePlanCalls(db *gorm.DB, plan *ActionPlan) error {
+	return db.Model(plan).Update("calls", plan.Calls).Error
+}
+
+// FinishPlan saves the outcome of running an approved plan's calls: approved when all
+// of them are done, failed otherwise
+func FinishPlan(db *gorm.DB, plan *ActionPlan) error {
+	plan.Status = PlanStatusApproved
+	for _, call := range plan.Calls {
+		if !call.Done {
+			plan.Status = PlanStatusFailed
+		}
+	}
+
+	updates := map[string]any{"status": plan.Status, "calls": plan.Calls}
+	if plan.Status == PlanStatusApproved {
+		now := time.Now()
+		updates["resolved_at"] = now
+		plan.ResolvedAt = &now
+	}
+	return db.Model(plan).Updates(updates).Error
+}
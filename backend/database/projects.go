@@ -0,0 +1,147 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrProjectCycle is returned when a parent assignment would make a project its own ancestor
+var ErrProjectCycle = errors.New("project can't be nested under itself or its descendants")
+
+// ProjectStats summarizes the tasks of a project together with all of its descendants
+type ProjectStats struct {
+	TotalTasks     int `json:"total_tasks"`
+	OpenTasks      int `json:"open_tasks"`
+	CompletedTasks int `json:"completed_tasks"`
+	OverdueTasks   int `json:"overdue_tasks"`
+}
+
+// ValidateProjectParent checks that parentID exists and that nesting project id under it
+// doesn't create a cycle. Pass id 0 for a project that hasn't been created yet.
+func ValidateProjectParent(db *gorm.DB, id, parentID uint) error {
+	if id != 0 && id == parentID {
+		return ErrProjectCycle
+	}
+
+	visited := map[uint]bool{}
+	current := &parentID
+	for current != nil {
+		if visited[*current] {
+			// An existing cycle upstream; refuse rather than loop forever
+			return ErrProjectCycle
+		}
+		visited[*current] = true
+
+		var ancestor Project
+		if err := db.Select("id", "parent_id").Where("id = ?", *current).First(&ancestor).Error; err != nil {
+			return err
+		}
+		if id != 0 && ancestor.ParentID != nil && *ancestor.ParentID == id {
+			return ErrProjectCycle
+		}
+		current = ancestor.ParentID
+	}
+
+	return nil
+}
+
+// BuildProjectTree nests projects under their parents, orders siblings by Order and
+// rolls up task statistics per subtree. Projects whose parent isn't in the list
+// (for example because it is archived) become roots.
+func BuildProjectTree(projects []Project, now time.Time) []Project {
+	byID := make(map[uint]bool, len(projects))
+	for _, p := range projects {
+		byID[p.ID] = true
+	}
+
+	children := map[uint][]int{}
+	var roots []int
+	for i, p := range projects {
+		if p.ParentID != nil && byID[*p.ParentID] && *p.ParentID != p.ID {
+			children[*p.ParentID] = append(children[*p.ParentID], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	visited := map[uint]bool{}
+	var build func(indices []int) []Project
+	build = func(indices []int) []Project {
+		sort.SliceStable(indices, func(a, b int) bool {
+			return projects[indices[a]].Order < projects[indices[b]].Order
+		})
+
+		nodes := make([]Project, 0, len(indices))
+		for _, i := range indices {
+			node := projects[i]
+			if visited[node.ID] {
+				continue
+			}
+			visited[node.ID] = true
+
+			stats := taskStats(node.Tasks, now)
+			node.Children = build(children[node.ID])
+			for _, child := range node.Children {
+				stats.TotalTasks += child.Stats.TotalTasks
+				stats.OpenTasks += child.Stats.OpenTasks
+				stats.CompletedTasks += child.Stats.CompletedTasks
+				stats.OverdueTasks += child.Stats.OverdueTasks
+			}
+			node.Stats = &stats
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+
+	return build(roots)
+}
+
+func taskStats(tasks []Task, now time.Time) ProjectStats {
+	var stats ProjectStats
+	for _, t := range tasks {
+		stats.TotalTasks++
+		if t.CompletedAt != nil {
+			stats.CompletedTasks++
+			continue
+		}
+		stats.OpenTasks++
+		if t.IsOverdue(now) {
+			stats.OverdueTasks++
+		}
+	}
+	return stats
+}
+
+// Duration is how long the entry lasted, or has been running until now
+func (e TimeEntry) Duration(now time.Time) time.Duration {
+	if e.EndedAt != nil {
+		return e.EndedAt.Sub(e.StartedAt)
+	}
+	return now.Sub(e.StartedAt)
+}
+
+// CurrentDue returns the due datetime if set, otherwise the due date
+func (t Task) CurrentDue() *time.Time {
+	if t.DueDatetime != nil {
+		return t.DueDatetime
+	}
+	return t.DueDate
+}
+
+// IsOverdue reports whether an open task's due date or datetime has passed
+func (t Task) IsOverdue(now time.Time) bool {
+	if t.CompletedAt != nil {
+		return false
+	}
+	if t.DueDatetime != nil {
+		return t.DueDatetime.Before(now)
+	}
+	if t.DueDate != nil {
+		// Date-only tasks are due until the end of the day
+		return !now.Before(t.DueDate.AddDate(0, 0, 1))
+	}
+	return false
+}
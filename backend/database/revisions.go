@@ -0,0 +1,41 @@
+package database
+
+import "gorm.io/gorm"
+
+// SaveRevision keeps the note's current title and content as a revision. Nothing is
+// saved when the edit doesn't touch either of them.
+func SaveRevision(db *gorm.DB, before Note, after Note) error {
+	if before.Title == after.Title && before.Content == after.Content {
+		return nil
+	}
+	return db.Create(&NoteRevision{
+		NoteID:   before.ID,
+		Title:    before.Title,
+		Content:  before.Content,
+		EditedAt: before.UpdatedAt,
+	}).Error
+}
+
+// RestoreRevision puts a revision's title and content back on its note. The version
+// being replaced is kept as a revision of its own, so a restore can be undone.
+func RestoreRevision(db *gorm.DB, noteID, revisionID uint) (Note, error) {
+	var note Note
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var revision NoteRevision
+		if err := tx.Where("id = ? AND note_id = ?", revisionID, noteID).First(&revision).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", noteID).First(&note).Error; err != nil {
+			return err
+		}
+
+		before := note
+		note.Title = revision.Title
+		note.Content = revision.Content
+		if err := tx.Model(&note).Select("title", "content").Updates(&note).Error; err != nil {
+			return err
+		}
+		return SaveRevision(tx, before, note)
+	})
+	return note, err
+}
@@ -0,0 +1,13 @@
+package database
+
+import "gorm.io/gorm"
+
+// ActiveProjects excludes archived projects
+func ActiveProjects(db *gorm.DB) *gorm.DB {
+	return db.Where("projects.archived_at IS NULL")
+}
+
+// TasksInActiveProjects excludes tasks that belong to archived projects
+func TasksInActiveProjects(db *gorm.DB) *gorm.DB {
+	return db.Where("NOT EXISTS (SELECT 1 FROM projects WHERE projects.id = tasks.project_id AND projects.archived_at IS NOT NULL)")
+}
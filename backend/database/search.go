@@ -0,0 +1,176 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dima-b/go-task-backend/logger"
+	"gorm.io/gorm"
+)
+
+// Search result types
+const (
+	SearchTypeTask       = "task"
+	SearchTypeNote       = "note"
+	SearchTypeTranscript = "transcript"
+)
+
+// SearchTypes lists every searchable type
+var SearchTypes = []string{SearchTypeTask, SearchTypeNote, SearchTypeTranscript}
+
+// searchHeadlineOptions configures ts_headline snippets
+const searchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=20, MinWords=5, MaxFragments=2, FragmentDelimiter=\" … \""
+
+// searchLanguage is the text search configuration of the search columns, set by SetupSearch
+var searchLanguage = "english"
+
+var languagePattern = regexp.MustCompile(`^[a-z_]+$`)
+
+// searchColumn describes a generated tsvector column and the text it indexes
+type searchColumn struct {
+	table      string
+	expression string
+}
+
+var searchColumns = []searchColumn{
+	{"tasks", "to_tsvector('%[1]s', coalesce(description, ''))"},
+	{"notes", "setweight(to_tsvector('%[1]s', coalesce(title, '')), 'A') || setweight(to_tsvector('%[1]s', coalesce(content, '')), 'B')"},
+	{"audios", "to_tsvector('%[1]s', coalesce(transcript, ''))"},
+}
+
+// SearchQuery describes a full-text search. Types limits the result types and
+// defaults to all of them.
+type SearchQuery struct {
+	Query           string
+	Types           []string
+	IncludeArchived bool
+	Limit           int
+	Offset          int
+}
+
+// SearchResult is a ranked match with a highlighted snippet
+type SearchResult struct {
+	Type      string    `json:"type"`
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	Snippet   string    `json:"snippet"`
+	Rank      float64   `json:"rank"`
+	ProjectID *uint     `json:"project_id,omitempty"`
+	NoteID    *uint     `json:"note_id,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetupSearch creates the generated search_vector columns and their GIN indexes. The
+// columns record the language they were built with and are rebuilt when it changes.
+func SetupSearch(db *gorm.DB, language string) error {
+	if !languagePattern.MatchString(language) {
+		return fmt.Errorf("invalid search language %q", language)
+	}
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM pg_ts_config WHERE cfgname = ?", language).Scan(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("unknown text search configuration %q", language)
+	}
+
+	for _, column := range searchColumns {
+		var current []string
+		err := db.Raw(`
+			SELECT COALESCE(col_description(attrelid, attnum), '') FROM pg_attribute
+			WHERE attrelid = ?::regclass AND attname = 'search_vector' AND NOT attisdropped`, column.table).
+			Scan(&current).Error
+		if err != nil {
+			return err
+		}
+
+		if len(current) == 0 || current[0] != language {
+			logger.Info("Building search column").Str("table", column.table).Str("language", language).Send()
+			statements := []string{
+				fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS search_vector", column.table),
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (%s) STORED", column.table, fmt.Sprintf(column.expression, language)),
+				fmt.Sprintf("COMMENT ON COLUMN %s.search_vector IS '%s'", column.table, language),
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				for _, statement := range statements {
+					if err := tx.Exec(statement).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		index := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_search_vector ON %[1]s USING GIN (search_vector)", column.table)
+		if err := db.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+
+	searchLanguage = language
+	return nil
+}
+
+// Search runs a web-style query ("quoted phrases", -exclusions, or) over tasks, notes and
+// audio transcripts, best matches first. Trashed items aren't searched.
+func Search(db *gorm.DB, q SearchQuery) ([]SearchResult, error) {
+	types := q.Types
+	if len(types) == 0 {
+		types = SearchTypes
+	}
+
+	var parts []string
+	for _, t := range types {
+		switch t {
+		case SearchTypeTask:
+			part := `
+				SELECT 'task' AS type, t.id, t.description AS title,
+					ts_headline(CAST(@lang AS regconfig), t.description, q.query, @options) AS snippet,
+					ts_rank(t.search_vector, q.query) AS rank, t.project_id, NULL::bigint AS note_id, t.updated_at
+				FROM tasks t, q
+				WHERE t.deleted_at IS NULL AND t.search_vector @@ q.query`
+			if !q.IncludeArchived {
+				part += ` AND NOT EXISTS (SELECT 1 FROM projects p WHERE p.id = t.project_id AND p.archived_at IS NOT NULL)`
+			}
+			parts = append(parts, part)
+		case SearchTypeNote:
+			parts = append(parts, `
+				SELECT 'note' AS type, n.id, n.title,
+					ts_headline(CAST(@lang AS regconfig), COALESCE(NULLIF(n.content, ''), n.title), q.query, @options) AS snippet,
+					ts_rank(n.search_vector, q.query) AS rank, NULL::bigint AS project_id, NULL::bigint AS note_id, n.updated_at
+				FROM notes n, q
+				WHERE n.deleted_at IS NULL AND n.search_vector @@ q.query`)
+		case SearchTypeTranscript:
+			parts = append(parts, `
+				SELECT 'transcript' AS type, a.id, COALESCE(n.title, '') AS title,
+					ts_headline(CAST(@lang AS regconfig), a.transcript, q.query, @options) AS snippet,
+					ts_rank(a.search_vector, q.query) AS rank, NULL::bigint AS project_id, n.id AS note_id, a.created_at AS updated_at
+				FROM audios a CROSS JOIN q
+				LEFT JOIN LATERAL (
+					SELECT id, title FROM notes WHERE notes.audio_id = a.id AND notes.deleted_at IS NULL ORDER BY id LIMIT 1
+				) n ON true
+				WHERE a.search_vector @@ q.query`)
+		default:
+			return nil, fmt.Errorf("unknown search type %q", t)
+		}
+	}
+
+	sql := `WITH q AS (SELECT websearch_to_tsquery(CAST(@lang AS regconfig), @query) AS query) ` +
+		strings.Join(parts, " UNION ALL ") +
+		` ORDER BY rank DESC, updated_at DESC LIMIT @limit OFFSET @offset`
+
+	var results []SearchResult
+	err := db.Raw(sql, map[string]any{
+		"lang":    searchLanguage,
+		"query":   q.Query,
+		"options": searchHeadlineOptions,
+		"limit":   q.Limit,
+		"offset":  q.Offset,
+	}).Scan(&results).Error
+	return results, err
+}
@@ -0,0 +1,147 @@
+package database
+
+import "time"
+
+// DateCount is a count for a calendar day, or for a week starting on Date
+type DateCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// CompletionTimeStats describes how long tasks took from creation to completion
+type CompletionTimeStats struct {
+	Count        int64    `json:"count"`
+	AverageHours *float64 `json:"average_hours"`
+	MedianHours  *float64 `json:"median_hours"`
+	P90Hours     *float64 `json:"p90_hours"`
+}
+
+// ProjectBreakdown summarizes activity within one project. TrackedMinutes covers time
+// entries started in the range; EstimatedMinutes sums the estimates of open tasks.
+type ProjectBreakdown struct {
+	ProjectID        uint    `json:"project_id"`
+	Name             string  `json:"name"`
+	Completed        int64   `json:"completed"`
+	Open             int64   `json:"open"`
+	Overdue          int64   `json:"overdue"`
+	TrackedMinutes   float64 `json:"tracked_minutes"`
+	EstimatedMinutes int64   `json:"estimated_minutes"`
+}
+
+// LabelBreakdown summarizes activity for one task label
+type LabelBreakdown struct {
+	Label     string `json:"label"`
+	Completed int64  `json:"completed"`
+	Open      int64  `json:"open"`
+}
+
+// StatsRange bounds a statistics query: completions at or after From and before To,
+// bucketed into calendar days of TimeZone
+type StatsRange struct {
+	From     time.Time
+	To       time.Time
+	TimeZone string
+}
+
+func (sr StatsRange) args() map[string]any {
+	return map[string]any{
+		"from": sr.From,
+		"to":   sr.To,
+		"tz":   sr.TimeZone,
+		"now":  time.Now(),
+	}
+}
+
+// CompletedPer counts completions per "day" or "week" in the range
+func CompletedPer(unit string, sr StatsRange) ([]DateCount, error) {
+	var counts []DateCount
+	err := DB.Raw(`
+		SELECT to_char(date_trunc(@unit, c.completed_at AT TIME ZONE @tz), 'YYYY-MM-DD') AS date, COUNT(*) AS count
+		FROM task_completions c
+		JOIN tasks t ON t.id = c.task_id
+		WHERE t.deleted_at IS NULL AND c.completed_at >= @from AND c.completed_at < @to
+		GROUP BY 1
+		ORDER BY 1`, withArg(sr.args(), "unit", unit)).Scan(&counts).Error
+	return counts, err
+}
+
+// OverdueTrend counts, for each day in the range, the tasks that were open and past due
+// at the end of that day. Recurring tasks only contribute their current occurrence.
+func OverdueTrend(sr StatsRange) ([]DateCount, error) {
+	var counts []DateCount
+	err := DB.Raw(`
+		SELECT to_char(d.day, 'YYYY-MM-DD') AS date, COUNT(t.id) AS count
+		FROM (
+			SELECT gs::date AS day, ((gs::date + 1)::timestamp AT TIME ZONE @tz) AS day_end
+			FROM generate_series((CAST(@from AS timestamptz) AT TIME ZONE @tz)::date::timestamp, ((CAST(@to AS timestamptz) - interval '1 second') AT TIME ZONE @tz)::date::timestamp, interval '1 day') AS gs
+		) d
+		LEFT JOIN tasks t ON t.deleted_at IS NULL AND t.created_at < d.day_end
+			AND COALESCE(t.due_datetime, t.due_date + interval '1 day') <= d.day_end
+			AND (t.completed_at IS NULL OR t.completed_at >= d.day_end)
+		GROUP BY d.day
+		ORDER BY d.day`, sr.args()).Scan(&counts).Error
+	return counts, err
+}
+
+// TimeToComplete measures creation-to-completion time of non-recurring tasks completed in the range
+func TimeToComplete(sr StatsRange) (CompletionTimeStats, error) {
+	var stats CompletionTimeStats
+	err := DB.Raw(`
+		SELECT COUNT(*) AS count,
+			AVG(EXTRACT(EPOCH FROM c.completed_at - t.created_at)) / 3600 AS average_hours,
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM c.completed_at - t.created_at)) / 3600 AS median_hours,
+			percentile_cont(0.9) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM c.completed_at - t.created_at)) / 3600 AS p90_hours
+		FROM task_completions c
+		JOIN tasks t ON t.id = c.task_id
+		WHERE t.deleted_at IS NULL AND COALESCE(t.recurrence, '') = ''
+			AND c.completed_at >= @from AND c.completed_at < @to`, sr.args()).Scan(&stats).Error
+	return stats, err
+}
+
+// ProjectBreakdowns reports completions and tracked time in the range plus current
+// open and overdue tasks for every active project
+func ProjectBreakdowns(sr StatsRange) ([]ProjectBreakdown, error) {
+	var rows []ProjectBreakdown
+	err := DB.Raw(`
+		SELECT p.id AS project_id, p.name AS name,
+			(SELECT COUNT(*) FROM task_completions c JOIN tasks t ON t.id = c.task_id
+				WHERE t.project_id = p.id AND t.deleted_at IS NULL AND c.completed_at >= @from AND c.completed_at < @to) AS completed,
+			(SELECT COUNT(*) FROM tasks t
+				WHERE t.project_id = p.id AND t.deleted_at IS NULL AND t.completed_at IS NULL) AS open,
+			(SELECT COUNT(*) FROM tasks t
+				WHERE t.project_id = p.id AND t.deleted_at IS NULL AND t.completed_at IS NULL
+					AND COALESCE(t.due_datetime, t.due_date + interval '1 day') <= @now) AS overdue,
+			(SELECT COALESCE(SUM(EXTRACT(EPOCH FROM COALESCE(e.ended_at, @now) - e.started_at)), 0) / 60
+				FROM time_entries e JOIN tasks t ON t.id = e.task_id
+				WHERE t.project_id = p.id AND t.deleted_at IS NULL AND e.started_at >= @from AND e.started_at < @to) AS tracked_minutes,
+			(SELECT COALESCE(SUM(t.estimated_minutes), 0) FROM tasks t
+				WHERE t.project_id = p.id AND t.deleted_at IS NULL AND t.completed_at IS NULL) AS estimated_minutes
+		FROM projects p
+		WHERE p.archived_at IS NULL AND p.deleted_at IS NULL
+		ORDER BY p."order", p.id`, sr.args()).Scan(&rows).Error
+	return rows, err
+}
+
+// LabelBreakdowns reports completions in the range and currently open tasks per label
+func LabelBreakdowns(sr StatsRange) ([]LabelBreakdown, error) {
+	var rows []LabelBreakdown
+	err := DB.Raw(`
+		SELECT label, SUM(completed) AS completed, SUM(open) AS open
+		FROM (
+			SELECT unnest(t.labels) AS label, 1 AS completed, 0 AS open
+			FROM task_completions c JOIN tasks t ON t.id = c.task_id
+			WHERE t.deleted_at IS NULL AND c.completed_at >= @from AND c.completed_at < @to
+			UNION ALL
+			SELECT unnest(t.labels) AS label, 0 AS completed, 1 AS open
+			FROM tasks t
+			WHERE t.deleted_at IS NULL AND t.completed_at IS NULL
+		) labelled
+		GROUP BY label
+		ORDER BY completed DESC, label`, sr.args()).Scan(&rows).Error
+	return rows, err
+}
+
+func withArg(args map[string]any, key string, value any) map[string]any {
+	args[key] = value
+	return args
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Trash holds the soft-deleted items that haven't been purged yet, most recent first
+type Trash struct {
+	Tasks    []Task    `json:"tasks"`
+	Projects []Project `json:"projects"`
+	Notes    []Note    `json:"notes"`
+}
+
+// PurgeResult counts the items permanently removed from the trash
+type PurgeResult struct {
+	Tasks    int64 `json:"tasks"`
+	Projects int64 `json:"projects"`
+	Notes    int64 `json:"notes"`
+}
+
+// ListTrash loads every soft-deleted task, project and note
+func ListTrash(db *gorm.DB) (Trash, error) {
+	var trash Trash
+	trashed := db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Session(&gorm.Session{})
+	if err := trashed.Find(&trash.Tasks).Error; err != nil {
+		return trash, err
+	}
+	if err := trashed.Find(&trash.Projects).Error; err != nil {
+		return trash, err
+	}
+	err := trashed.Find(&trash.Notes).Error
+	return trash, err
+}
+
+// RestoreTask brings a task back from the trash. It returns to its project with its
+// previous order, or to the end of the Inbox if the project is gone.
+func RestoreTask(db *gorm.DB, id uint) (Task, error) {
+	var task Task
+	if err := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&task).Error; err != nil {
+		return task, err
+	}
+
+	updates := map[string]any{"deleted_at": nil}
+	projectExists := false
+	if task.ProjectID != nil {
+		var count int64
+		if err := db.Model(&Project{}).Where("id = ?", *task.ProjectID).Count(&count).Error; err != nil {
+			return task, err
+		}
+		projectExists = count > 0
+	}
+	if !projectExists {
+		var maxOrder int
+		if err := db.Model(&Task{}).Select(`COALESCE(MAX("order"), 0)`).Where("project_id = ?", InboxProjectID).Scan(&maxOrder).Error; err != nil {
+			return task, err
+		}
+		updates["project_id"] = InboxProjectID
+		updates["order"] = maxOrder + 1
+	}
+
+	if err := db.Unscoped().Model(&task).Updates(updates).Error; err != nil {
+		return task, err
+	}
+	err := db.Where("id = ?", id).First(&task).Error
+	return task, err
+}
+
+// RestoreProject brings a project back from the trash together with the tasks that were
+// deleted along with it, and takes back the subprojects that moved up when it was
+// deleted. It moves to the top level if its parent is gone.
+func RestoreProject(db *gorm.DB, id uint) (Project, error) {
+	var project Project
+	if err := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&project).Error; err != nil {
+		return project, err
+	}
+
+	updates := map[string]any{"deleted_at": nil}
+	if project.ParentID != nil {
+		var count int64
+		if err := db.Model(&Project{}).Where("id = ?", *project.ParentID).Count(&count).Error; err != nil {
+			return project, err
+		}
+		if count == 0 {
+			updates["parent_id"] = nil
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&project).Updates(updates).Error; err != nil {
+			return err
+		}
+		// Tasks trashed by a cascading project delete share its timestamp
+		err := tx.Unscoped().Model(&Task{}).
+			Where("project_id = ? AND deleted_at = ?", id, project.DeletedAt.Time).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		// Subprojects that moved up return, unless they were moved elsewhere since
+		err = tx.Model(&Project{}).
+			Where("trashed_parent_id = ? AND parent_id IS NOT DISTINCT FROM ?", id, project.ParentID).
+			Update("parent_id", id).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&Project{}).Where("trashed_parent_id = ?", id).Update("trashed_parent_id", nil).Error
+	})
+	if err != nil {
+		return project, err
+	}
+	err = db.Where("id = ?", id).First(&project).Error
+	return project, err
+}
+
+// RestoreNote brings a note back from the trash
+func RestoreNote(db *gorm.DB, id uint) (Note, error) {
+	var note Note
+	if err := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&note).Error; err != nil {
+		return note, err
+	}
+	if err := db.Unscoped().Model(&note).Update("deleted_at", nil).Error; err != nil {
+		return note, err
+	}
+	err := db.Where("id = ?", id).First(&note).Error
+	return note, err
+}
+
+// PurgeTrash permanently deletes items that were trashed before cutoff. Their
+// completions, time entries, dependencies and comments go with them.
+func PurgeTrash(db *gorm.DB, cutoff time.Time) (PurgeResult, error) {
+	var purged PurgeResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("deleted_at < ?", cutoff).Delete(&Task{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged.Tasks = result.RowsAffected
+
+		// Trashed tasks that outlive their project move to the Inbox, and subprojects
+		// to the top level
+		expired := tx.Unscoped().Model(&Project{}).Select("id").Where("deleted_at < ?", cutoff).Session(&gorm.Session{})
+		if err := tx.Unscoped().Model(&Task{}).Where("project_id IN (?)", expired).UpdateColumn("project_id", InboxProjectID).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&Project{}).Where("parent_id IN (?)", expired).UpdateColumn("parent_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&Project{}).Where("trashed_parent_id IN (?)", expired).UpdateColumn("trashed_parent_id", nil).Error; err != nil {
+			return err
+		}
+		result = tx.Unscoped().Where("deleted_at < ?", cutoff).Delete(&Project{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged.Projects = result.RowsAffected
+
+		result = tx.Unscoped().Where("deleted_at < ?", cutoff).Delete(&Note{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged.Notes = result.RowsAffected
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TaskDependencyRequest struct {
+	BlockedByID uint `json:"blocked_by_id"`
+}
+
+// listTaskDependencies returns the tasks the given task waits on, completed or not
+func listTaskDependencies(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Listing task dependencies").Uint("task_id", id).Send()
+
+	if !taskExists(w, id) {
+		return
+	}
+
+	var tasks []database.Task
+	result := database.DB.Preload("Project").
+		Where("id IN (?)", database.DB.Model(&database.TaskDependency{}).Select("blocked_by_id").Where("task_id = ?", id)).
+		Order("id").
+		Find(&tasks)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve task dependencies").Uint("task_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := database.FillBlocked(database.DB, tasks); err != nil {
+		logger.Error("Failed to retrieve task dependencies").Uint("task_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully retrieved task dependencies").Uint("task_id", id).Int64("count", result.RowsAffected).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
+
+func addTaskDependency(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+
+	var req TaskDependencyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode task dependency request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.BlockedByID == 0 {
+		http.Error(w, "blocked_by_id is required", http.StatusBadRequest)
+		return
+	}
+	logger.Info("Adding task dependency").Uint("task_id", id).Uint("blocked_by_id", req.BlockedByID).Send()
+
+	if !taskExists(w, id) || !taskExists(w, req.BlockedByID) {
+		return
+	}
+
+	dependency := database.TaskDependency{TaskID: id, BlockedByID: req.BlockedByID}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.ValidateDependency(tx, id, req.BlockedByID); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&dependency).Error; err != nil {
+			return err
+		}
+		// The task's blocked state changed
+		return tx.Model(&database.Task{}).Where("id = ?", id).UpdateColumn("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrRecurringPrerequisite) {
+			logger.Error("Refusing dependency on recurring task").Uint("task_id", id).Uint("blocked_by_id", req.BlockedByID).Send()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, database.ErrDependencyCycle) {
+			logger.Error("Refusing dependency cycle").Uint("task_id", id).Uint("blocked_by_id", req.BlockedByID).Send()
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		logger.Error("Failed to add task dependency").Uint("task_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully added task dependency").Uint("task_id", id).Uint("blocked_by_id", req.BlockedByID).Send()
+	json.NewEncoder(w).Encode(dependency)
+}
+
+func removeTaskDependency(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	blockedByID, ok := utils.ParseIDFromURL(r, w, "blockedByID")
+	if !ok {
+		return
+	}
+	logger.Info("Removing task dependency").Uint("task_id", id).Uint("blocked_by_id", blockedByID).Send()
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("task_id = ? AND blocked_by_id = ?", id, blockedByID).Delete(&database.TaskDependency{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&database.Task{}).Where("id = ?", id).UpdateColumn("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logger.Error("Task dependency not found").Uint("task_id", id).Uint("blocked_by_id", blockedByID).Send()
+			http.Error(w, "Task dependency not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to remove task dependency").Uint("task_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully removed task dependency").Uint("task_id", id).Uint("blocked_by_id", blockedByID).Send()
+	w.WriteHeader(http.StatusOK)
+}
@@ -3,13 +3,24 @@ package env
 import (
 	"fmt"
 	"os"
+	"strconv"
 )
 
 type Env struct {
-	ElevenLabsAPIKey string
-	LogLevel         string
-	LogFormat        string
-	DatabaseURL      string
+	ElevenLabsAPIKey   string
+	LogLevel           string
+	LogFormat          string
+	DatabaseURL        string
+	TrashRetentionDays int
+	SearchLanguage     string
+	OpenRouterAPIKey   string
+	AIBaseURL          string
+	AIAPIKey           string
+	AIModel            string
+	AITimeoutSeconds   int
+	AITokenBudget      int
+	AIHistoryTokens    int
+	AIBulkWriteLimit   int
 }
 
 func New() (*Env, error) {
@@ -31,6 +42,52 @@ func New() (*Env, error) {
 	// Optional environment variables with defaults
 	env.LogLevel = getEnvOrDefault("LOG_LEVEL", "info")
 	env.LogFormat = getEnvOrDefault("LOG_FORMAT", "text")
+
+	trashRetentionDays, err := strconv.Atoi(getEnvOrDefault("TRASH_RETENTION_DAYS", "30"))
+	if err != nil || trashRetentionDays <= 0 {
+		return nil, fmt.Errorf("TRASH_RETENTION_DAYS must be a positive number of days")
+	}
+	env.TrashRetentionDays = trashRetentionDays
+
+	// Postgres text search configuration used for stemming, e.g. "english" or "simple"
+	env.SearchLanguage = getEnvOrDefault("SEARCH_LANGUAGE", "english")
+
+	// AI commands use an OpenAI-compatible server at AI_BASE_URL (e.g. a local Ollama)
+	// when set, otherwise OpenRouter. They are disabled without either.
+	env.OpenRouterAPIKey = os.Getenv("OPENROUTER_API_KEY")
+	env.AIBaseURL = os.Getenv("AI_BASE_URL")
+	env.AIAPIKey = os.Getenv("AI_API_KEY")
+	env.AIModel = os.Getenv("AI_MODEL")
+	if env.AIBaseURL != "" && env.AIModel == "" {
+		return nil, fmt.Errorf("AI_MODEL is required with AI_BASE_URL")
+	}
+
+	aiTimeoutSeconds, err := strconv.Atoi(getEnvOrDefault("AI_TIMEOUT_SECONDS", "60"))
+	if err != nil || aiTimeoutSeconds <= 0 {
+		return nil, fmt.Errorf("AI_TIMEOUT_SECONDS must be a positive number of seconds")
+	}
+	env.AITimeoutSeconds = aiTimeoutSeconds
+
+	// Tokens a single AI command may use across all its model calls, 0 for no limit
+	aiTokenBudget, err := strconv.Atoi(getEnvOrDefault("AI_TOKEN_BUDGET", "20000"))
+	if err != nil || aiTokenBudget < 0 {
+		return nil, fmt.Errorf("AI_TOKEN_BUDGET must be a number of tokens")
+	}
+	env.AITokenBudget = aiTokenBudget
+
+	// Conversation history sent to the model; older messages are summarized
+	aiHistoryTokens, err := strconv.Atoi(getEnvOrDefault("AI_HISTORY_TOKENS", "4000"))
+	if err != nil || aiHistoryTokens <= 0 {
+		return nil, fmt.Errorf("AI_HISTORY_TOKENS must be a positive number of tokens")
+	}
+	env.AIHistoryTokens = aiHistoryTokens
+
+	// Changes an AI command may make without approval, 0 for no limit
+	aiBulkWriteLimit, err := strconv.Atoi(getEnvOrDefault("AI_BULK_WRITE_LIMIT", "3"))
+	if err != nil || aiBulkWriteLimit < 0 {
+		return nil, fmt.Errorf("AI_BULK_WRITE_LIMIT must be a number of changes")
+	}
+	env.AIBulkWriteLimit = aiBulkWriteLimit
 	
 	return env, nil
 }
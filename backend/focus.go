@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+)
+
+// Defaults for a classic Pomodoro session
+const (
+	defaultFocusMinutes     = 25
+	defaultBreakMinutes     = 5
+	defaultLongBreakMinutes = 15
+	defaultFocusCycles      = 4
+)
+
+// errFocusSessionActive is returned when a session is started while another one is active
+var errFocusSessionActive = errors.New("a focus session is already active")
+
+type FocusSessionRequest struct {
+	TaskID           *uint `json:"task_id"`
+	FocusMinutes     int   `json:"focus_minutes"`
+	BreakMinutes     *int  `json:"break_minutes"`
+	LongBreakMinutes *int  `json:"long_break_minutes"`
+	Cycles           int   `json:"cycles"`
+}
+
+func startFocusSession(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Starting focus session").Send()
+
+	var req FocusSessionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode focus session request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session := database.FocusSession{
+		TaskID:           req.TaskID,
+		FocusMinutes:     req.FocusMinutes,
+		BreakMinutes:     defaultBreakMinutes,
+		LongBreakMinutes: defaultLongBreakMinutes,
+		Cycles:           req.Cycles,
+	}
+	if session.FocusMinutes == 0 {
+		session.FocusMinutes = defaultFocusMinutes
+	}
+	if session.Cycles == 0 {
+		session.Cycles = defaultFocusCycles
+	}
+	if req.BreakMinutes != nil {
+		session.BreakMinutes = *req.BreakMinutes
+	}
+	if req.LongBreakMinutes != nil {
+		session.LongBreakMinutes = *req.LongBreakMinutes
+	}
+	if err := database.ValidateFocusSession(&session); err != nil {
+		logger.Error("Invalid focus session").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if session.TaskID != nil && !taskExists(w, *session.TaskID) {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		active, err := loadActiveFocusSession(tx)
+		if err != nil {
+			return err
+		}
+		if active != nil {
+			return errFocusSessionActive
+		}
+		session.Start(time.Now())
+		return tx.Create(&session).Error
+	})
+	if err != nil {
+		if errors.Is(err, errFocusSessionActive) {
+			logger.Error("Focus session already active").Send()
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		logger.Error("Failed to start focus session").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully started focus session").Uint("session_id", session.ID).Send()
+	json.NewEncoder(w).Encode(session)
+}
+
+func getCurrentFocusSession(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Getting current focus session").Send()
+
+	var session *database.FocusSession
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		session, err = loadActiveFocusSession(tx)
+		return err
+	})
+	if err != nil {
+		logger.Error("Failed to retrieve focus session").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+func listFocusSessions(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing focus sessions").Send()
+
+	query := database.DB.Order("started_at DESC").Limit(50)
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 {
+		query = query.Limit(limit)
+	}
+	if taskID := r.URL.Query().Get("task_id"); taskID != "" {
+		query = query.Where("task_id = ?", taskID)
+	}
+
+	var sessions []database.FocusSession
+	result := query.Find(&sessions)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve focus sessions").Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Reading history shouldn't show a phase that has already ended
+	now := time.Now()
+	for i := range sessions {
+		sessions[i].Advance(now)
+	}
+
+	logger.Info("Successfully retrieved focus sessions").Int64("count", result.RowsAffected).Send()
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func pauseFocusSession(w http.ResponseWriter, r *http.Request) {
+	updateFocusSession(w, r, "pause", func(s *database.FocusSession, now time.Time) ([]database.FocusInterval, error) {
+		return s.Pause(now)
+	})
+}
+
+func resumeFocusSession(w http.ResponseWriter, r *http.Request) {
+	updateFocusSession(w, r, "resume", func(s *database.FocusSession, now time.Time) ([]database.FocusInterval, error) {
+		return nil, s.Resume(now)
+	})
+}
+
+func abortFocusSession(w http.ResponseWriter, r *http.Request) {
+	updateFocusSession(w, r, "abort", func(s *database.FocusSession, now time.Time) ([]database.FocusInterval, error) {
+		return s.Abort(now)
+	})
+}
+
+// updateFocusSession applies a state transition to a session and persists it together
+// with the focus time it produced
+func updateFocusSession(w http.ResponseWriter, r *http.Request, action string, transition func(*database.FocusSession, time.Time) ([]database.FocusInterval, error)) {
+	id, ok := utils.ParseIDFromURL(r, w, "sessionID")
+	if !ok {
+		return
+	}
+	logger.Info("Updating focus session").Uint("session_id", id).Str("action", action).Send()
+
+	var session database.FocusSession
+	var transitionErr error
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", id).First(&session).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		intervals := session.Advance(now)
+		var more []database.FocusInterval
+		more, transitionErr = transition(&session, now)
+		intervals = append(intervals, more...)
+
+		// Persist elapsed phases even when the action itself is rejected
+		return saveFocusSession(tx, &session, intervals)
+	})
+	if err == nil {
+		err = transitionErr
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logger.Error("Focus session not found").Uint("session_id", id).Send()
+			http.Error(w, "Focus session not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrInvalidFocusTransition) {
+			logger.Error("Invalid focus session transition").Uint("session_id", id).Str("action", action).Str("state", session.State).Send()
+			http.Error(w, "Can't "+action+" a session that is "+session.State, http.StatusConflict)
+			return
+		}
+		logger.Error("Failed to update focus session").Uint("session_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully updated focus session").Uint("session_id", id).Str("state", session.State).Send()
+	json.NewEncoder(w).Encode(session)
+}
+
+// loadActiveFocusSession returns the active session advanced to the current time, or nil
+func loadActiveFocusSession(tx *gorm.DB) (*database.FocusSession, error) {
+	var session database.FocusSession
+	result := tx.Scopes(database.ActiveFocusSessions).Limit(1).Find(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	intervals := session.Advance(time.Now())
+	if len(intervals) > 0 || !session.IsActive() {
+		if err := saveFocusSession(tx, &session, intervals); err != nil {
+			return nil, err
+		}
+	}
+	if !session.IsActive() {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// saveFocusSession stores the session and logs its finished focus intervals as time entries
+func saveFocusSession(tx *gorm.DB, session *database.FocusSession, intervals []database.FocusInterval) error {
+	if err := tx.Save(session).Error; err != nil {
+		return err
+	}
+	if session.TaskID == nil {
+		return nil
+	}
+	for _, interval := range intervals {
+		if !interval.End.After(interval.Start) {
+			continue
+		}
+		end := interval.End
+		entry := database.TimeEntry{
+			TaskID:    *session.TaskID,
+			StartedAt: interval.Start,
+			EndedAt:   &end,
+			Note:      "Focus session",
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
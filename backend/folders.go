@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+)
+
+type FolderResponse struct {
+	database.Folder
+	NoteCount int64 `json:"note_count"`
+}
+
+func listFolders(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing folders").Send()
+
+	var folders []FolderResponse
+	result := database.DB.Model(&database.Folder{}).
+		Select(`folders.*, (SELECT COUNT(*) FROM notes WHERE notes.folder_id = folders.id AND notes.deleted_at IS NULL) AS note_count`).
+		Order(`"order", id`).
+		Find(&folders)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve folders").Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully retrieved folders").Int64("count", result.RowsAffected).Send()
+	json.NewEncoder(w).Encode(folders)
+}
+
+func createFolder(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Creating new folder").Send()
+
+	var f database.Folder
+	err := json.NewDecoder(r.Body).Decode(&f)
+	if err != nil {
+		logger.Error("Failed to decode folder request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	// Set order if not provided
+	if f.Order == 0 {
+		var maxOrder int
+		database.DB.Model(&database.Folder{}).Select(`COALESCE(MAX("order"), 0)`).Scan(&maxOrder)
+		f.Order = maxOrder + 1
+	}
+
+	result := database.DB.Create(&f)
+	if result.Error != nil {
+		logger.Error("Failed to create folder").Err(result.Error).Str("name", f.Name).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully created folder").Uint("folder_id", f.ID).Str("name", f.Name).Send()
+	json.NewEncoder(w).Encode(f)
+}
+
+func updateFolder(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Updating folder").Send()
+
+	id, ok := utils.ParseIDFromURL(r, w, "folderID")
+	if !ok {
+		return
+	}
+
+	var f database.Folder
+	err := json.NewDecoder(r.Body).Decode(&f)
+	if err != nil {
+		logger.Error("Failed to decode folder update request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := database.DB.Model(&database.Folder{}).Where("id = ?", id).Updates(f)
+	if result.Error != nil {
+		logger.Error("Failed to update folder").Uint("folder_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		logger.Error("Folder not found").Uint("folder_id", id).Send()
+		http.Error(w, "Folder not found", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("Successfully updated folder").Uint("folder_id", id).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+func deleteFolder(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Deleting folder").Send()
+
+	id, ok := utils.ParseIDFromURL(r, w, "folderID")
+	if !ok {
+		return
+	}
+
+	// Notes in the folder stay, without a folder
+	result := database.DB.Delete(&database.Folder{}, id)
+	if result.Error != nil {
+		logger.Error("Failed to delete folder").Uint("folder_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully deleted folder").Uint("folder_id", id).Send()
+	w.WriteHeader(http.StatusOK)
+}
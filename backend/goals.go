@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+)
+
+func listGoals(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing goals").Send()
+
+	var goals []database.Goal
+	result := database.DB.Scopes(database.PreloadGoal).Order("id").Find(&goals)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve goals").Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	for i := range goals {
+		goals[i].ComputeProgress(now)
+	}
+
+	logger.Info("Successfully retrieved goals").Int64("count", result.RowsAffected).Send()
+	json.NewEncoder(w).Encode(goals)
+}
+
+func getGoal(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseGoalID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Getting goal").Uint("goal_id", id).Send()
+
+	goal, ok := loadGoal(w, id)
+	if !ok {
+		return
+	}
+
+	logger.Info("Successfully retrieved goal").Uint("goal_id", id).Send()
+	json.NewEncoder(w).Encode(goal)
+}
+
+func createGoal(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Creating new goal").Send()
+
+	var g database.Goal
+	err := json.NewDecoder(r.Body).Decode(&g)
+	if err != nil {
+		logger.Error("Failed to decode goal request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if g.MetricType == "" {
+		g.MetricType = database.GoalMetricCount
+	}
+	if err := database.ValidateGoal(&g); err != nil {
+		logger.Error("Invalid goal").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateGoalLinks(g.ProjectIDs, g.TaskIDs); err != nil {
+		logger.Error("Invalid goal links").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check-ins have their own endpoints
+	g.CheckIns = nil
+	g.Projects = projectRefs(g.ProjectIDs)
+	g.Tasks = taskRefs(g.TaskIDs)
+
+	result := database.DB.Omit("Projects.*", "Tasks.*").Create(&g)
+	if result.Error != nil {
+		logger.Error("Failed to create goal").Err(result.Error).Str("title", g.Title).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully created goal").Uint("goal_id", g.ID).Str("title", g.Title).Send()
+
+	goal, ok := loadGoal(w, g.ID)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(goal)
+}
+
+func updateGoal(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseGoalID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Updating goal").Uint("goal_id", id).Send()
+
+	var body json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		logger.Error("Failed to decode goal update request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var existing database.Goal
+	result := database.DB.Where("id = ?", id).First(&existing)
+	if result.Error != nil {
+		writeGoalLookupError(w, id, result.Error)
+		return
+	}
+
+	// Apply the body on top of the stored goal so partial updates validate correctly
+	g := existing
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &g); err != nil {
+		logger.Error("Failed to decode goal update request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		logger.Error("Failed to decode goal update request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := database.ValidateGoal(&g); err != nil {
+		logger.Error("Invalid goal").Uint("goal_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateGoalLinks(g.ProjectIDs, g.TaskIDs); err != nil {
+		logger.Error("Invalid goal links").Uint("goal_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&existing).
+			Select("Title", "Description", "MetricType", "StartValue", "TargetValue", "Unit", "Deadline").
+			Updates(g).Error
+		if err != nil {
+			return err
+		}
+		if _, ok := fields["project_ids"]; ok {
+			if err := tx.Model(&existing).Omit("Projects.*").Association("Projects").Replace(projectRefs(g.ProjectIDs)); err != nil {
+				return err
+			}
+		}
+		if _, ok := fields["task_ids"]; ok {
+			if err := tx.Model(&existing).Omit("Tasks.*").Association("Tasks").Replace(taskRefs(g.TaskIDs)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to update goal").Uint("goal_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully updated goal").Uint("goal_id", id).Send()
+
+	goal, ok := loadGoal(w, id)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(goal)
+}
+
+func deleteGoal(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Deleting goal").Send()
+
+	id, ok := utils.ParseGoalID(r, w)
+	if !ok {
+		return
+	}
+
+	result := database.DB.Select("Projects", "Tasks").Delete(&database.Goal{ID: id})
+	if result.Error != nil {
+		logger.Error("Failed to delete goal").Uint("goal_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully deleted goal").Uint("goal_id", id).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+func createGoalCheckIn(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseGoalID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Adding goal check-in").Uint("goal_id", id).Send()
+
+	var c database.GoalCheckIn
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		logger.Error("Failed to decode check-in request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var goal database.Goal
+	result := database.DB.Where("id = ?", id).First(&goal)
+	if result.Error != nil {
+		writeGoalLookupError(w, id, result.Error)
+		return
+	}
+
+	c.ID = 0
+	c.GoalID = id
+	if c.CheckedAt.IsZero() {
+		c.CheckedAt = time.Now()
+	}
+	// A bare check-in counts as one step, or as done for boolean goals
+	if c.Value == 0 && goal.MetricType != database.GoalMetricNumeric {
+		c.Value = 1
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&c).Error; err != nil {
+			return err
+		}
+		return tx.Model(&goal).Update("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		logger.Error("Failed to create check-in").Uint("goal_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully added goal check-in").Uint("goal_id", id).Uint("check_in_id", c.ID).Send()
+	json.NewEncoder(w).Encode(c)
+}
+
+func deleteGoalCheckIn(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseGoalID(r, w)
+	if !ok {
+		return
+	}
+	checkInID, ok := utils.ParseIDFromURL(r, w, "checkInID")
+	if !ok {
+		return
+	}
+	logger.Info("Deleting goal check-in").Uint("goal_id", id).Uint("check_in_id", checkInID).Send()
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND goal_id = ?", checkInID, id).Delete(&database.GoalCheckIn{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&database.Goal{}).Where("id = ?", id).Update("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logger.Error("Check-in not found").Uint("goal_id", id).Uint("check_in_id", checkInID).Send()
+			http.Error(w, "Check-in not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to delete check-in").Uint("check_in_id", checkInID).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully deleted goal check-in").Uint("check_in_id", checkInID).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+// loadGoal fetches a goal with computed progress, writing an error response on failure
+func loadGoal(w http.ResponseWriter, id uint) (database.Goal, bool) {
+	var goal database.Goal
+	result := database.DB.Scopes(database.PreloadGoal).Where("id = ?", id).First(&goal)
+	if result.Error != nil {
+		writeGoalLookupError(w, id, result.Error)
+		return goal, false
+	}
+	goal.ComputeProgress(time.Now())
+	return goal, true
+}
+
+func writeGoalLookupError(w http.ResponseWriter, id uint, err error) {
+	if err == gorm.ErrRecordNotFound {
+		logger.Error("Goal not found").Uint("goal_id", id).Send()
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+	logger.Error("Failed to fetch goal").Uint("goal_id", id).Err(err).Send()
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// validateGoalLinks checks that every linked project and task exists
+func validateGoalLinks(projectIDs, taskIDs []uint) error {
+	if err := checkIDsExist(&database.Project{}, projectIDs); err != nil {
+		return fmt.Errorf("invalid project_ids: %w", err)
+	}
+	if err := checkIDsExist(&database.Task{}, taskIDs); err != nil {
+		return fmt.Errorf("invalid task_ids: %w", err)
+	}
+	return nil
+}
+
+func checkIDsExist(model any, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	unique := map[uint]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	var count int64
+	if err := database.DB.Model(model).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(unique) {
+		return fmt.Errorf("%d of %d not found", len(unique)-int(count), len(unique))
+	}
+	return nil
+}
+
+func projectRefs(ids []uint) []database.Project {
+	projects := make([]database.Project, 0, len(ids))
+	for _, id := range ids {
+		projects = append(projects, database.Project{ID: id})
+	}
+	return projects
+}
+
+func taskRefs(ids []uint) []database.Task {
+	tasks := make([]database.Task, 0, len(ids))
+	for _, id := range ids {
+		tasks = append(tasks, database.Task{ID: id})
+	}
+	return tasks
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultHabitPeriod is how far back habit statistics look when no range is given
+const defaultHabitPeriod = 365
+
+type HabitResponse struct {
+	Task  database.Task    `json:"task"`
+	Stats utils.HabitStats `json:"stats"`
+}
+
+type HabitCheckInRequest struct {
+	Date string `json:"date"`
+}
+
+func listHabits(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing habits").Send()
+
+	loc, err := utils.QueryLocation(r)
+	if err != nil {
+		logger.Error("Invalid time zone").Str("tz", r.URL.Query().Get("tz")).Err(err).Send()
+		http.Error(w, "Invalid tz", http.StatusBadRequest)
+		return
+	}
+
+	var tasks []database.Task
+	result := database.DB.Preload("Project").Preload("Completions").
+		Scopes(database.TasksInActiveProjects).
+		Where("is_habit = ?", true).Order(`"order"`).Find(&tasks)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve habits").Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	habits := make([]HabitResponse, 0, len(tasks))
+	for _, task := range tasks {
+		stats, err := habitStats(task, loc, now.AddDate(0, 0, -defaultHabitPeriod), now, now, false)
+		if err != nil {
+			logger.Error("Failed to compute habit stats").Uint("task_id", task.ID).Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		habits = append(habits, HabitResponse{Task: task, Stats: stats})
+	}
+
+	logger.Info("Successfully retrieved habits").Int("count", len(habits)).Send()
+	json.NewEncoder(w).Encode(habits)
+}
+
+func getHabitStats(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Getting habit stats").Uint("task_id", id).Send()
+
+	loc, err := utils.QueryLocation(r)
+	if err != nil {
+		logger.Error("Invalid time zone").Str("tz", r.URL.Query().Get("tz")).Err(err).Send()
+		http.Error(w, "Invalid tz", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().In(loc)
+	to, err := utils.ParseDateParam(r.URL.Query().Get("to"), loc, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := utils.ParseDateParam(r.URL.Query().Get("from"), loc, to.AddDate(0, 0, -defaultHabitPeriod))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task, ok := loadHabit(w, id)
+	if !ok {
+		return
+	}
+
+	stats, err := habitStats(task, loc, from, to, now, true)
+	if err != nil {
+		logger.Error("Failed to compute habit stats").Uint("task_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully computed habit stats").Uint("task_id", id).Int("current_streak", stats.CurrentStreak).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HabitResponse{Task: task, Stats: stats})
+}
+
+func createHabitCheckIn(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Adding habit check-in").Uint("task_id", id).Send()
+
+	var req HabitCheckInRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode check-in request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	day, err := utils.ParseDateParam(req.Date, time.UTC, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if day.After(now) {
+		http.Error(w, "Can't check in for a future date", http.StatusBadRequest)
+		return
+	}
+
+	task, ok := loadHabit(w, id)
+	if !ok {
+		return
+	}
+
+	completion := database.TaskCompletion{
+		TaskID:      task.ID,
+		OccurredOn:  day,
+		CompletedAt: now,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&completion).Error; err != nil {
+			return err
+		}
+		return tx.Model(&task).Update("updated_at", now).Error
+	})
+	if err != nil {
+		logger.Error("Failed to create habit check-in").Uint("task_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully added habit check-in").Uint("task_id", id).Str("date", day.Format(utils.DateLayout)).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+func deleteHabitCheckIn(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+
+	date := chi.URLParam(r, "date")
+	day, err := time.ParseInLocation(utils.DateLayout, date, time.UTC)
+	if err != nil {
+		logger.Error("Invalid check-in date").Str("date", date).Err(err).Send()
+		http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	logger.Info("Deleting habit check-in").Uint("task_id", id).Str("date", date).Send()
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("task_id = ? AND occurred_on = ?", id, day).Delete(&database.TaskCompletion{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&database.Task{}).Where("id = ?", id).Update("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logger.Error("Habit check-in not found").Uint("task_id", id).Str("date", date).Send()
+			http.Error(w, "Check-in not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to delete habit check-in").Uint("task_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully deleted habit check-in").Uint("task_id", id).Str("date", date).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+// loadHabit fetches a habit task with its completions, writing an error response on failure
+func loadHabit(w http.ResponseWriter, id uint) (database.Task, bool) {
+	var task database.Task
+	result := database.DB.Preload("Project").Preload("Completions").Where("id = ?", id).First(&task)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			logger.Error("Task not found").Uint("task_id", id).Send()
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return task, false
+		}
+		logger.Error("Failed to fetch task").Uint("task_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return task, false
+	}
+	if !task.IsHabit {
+		logger.Error("Task is not a habit").Uint("task_id", id).Send()
+		http.Error(w, "Task is not a habit", http.StatusBadRequest)
+		return task, false
+	}
+	return task, true
+}
+
+func habitStats(task database.Task, loc *time.Location, from, to, now time.Time, heatmap bool) (utils.HabitStats, error) {
+	// Completion dates are calendar days, so read them as such in the requested zone
+	checkIns := make([]time.Time, 0, len(task.Completions))
+	for _, c := range task.Completions {
+		checkIns = append(checkIns, time.Date(c.OccurredOn.Year(), c.OccurredOn.Month(), c.OccurredOn.Day(), 0, 0, 0, 0, loc))
+	}
+
+	anchor := task.CreatedAt
+	if due := task.CurrentDue(); due != nil {
+		anchor = *due
+	}
+
+	return utils.ComputeHabitStats(utils.HabitOptions{
+		Recurrence: task.Recurrence,
+		Anchor:     anchor,
+		Start:      task.CreatedAt,
+		From:       from,
+		To:         to,
+		Today:      now,
+		CheckIns:   checkIns,
+		Location:   loc,
+		Heatmap:    heatmap,
+	})
+}
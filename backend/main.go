@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"github.com/dima-b/go-task-backend/middleware"
 	"github.com/dima-b/go-task-backend/utils"
 	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/joho/godotenv"
 	"gorm.io/gorm"
@@ -49,12 +51,24 @@ func main() {
 
 	logger.Info("Database initialized successfully").Send()
 
+	err = database.SetupSearch(database.DB, appEnv.SearchLanguage)
+	if err != nil {
+		logger.Error("Unable to set up search").Str("language", appEnv.SearchLanguage).Err(err).Send()
+		return
+	}
+
+	aiProvider = newAIProvider(appEnv)
+
+	// Remove items that have been in the trash for longer than the retention period
+	go runTrashPurge(time.Duration(appEnv.TrashRetentionDays) * 24 * time.Hour)
+
 	r := chi.NewRouter()
+	r.Use(chimiddleware.RequestID)
 	r.Use(middleware.LoggingMiddleware)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", deviceIDHeader, chimiddleware.RequestIDHeader},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300,
@@ -72,17 +86,44 @@ func main() {
 			r.Put("/", updateTask)
 			r.Delete("/", deleteTask)
 			r.Post("/complete", completeTask)
+			r.Post("/timer/start", startTimer)
+			r.Post("/timer/stop", stopTimer)
+			r.Get("/time", getTaskTime)
+			r.Post("/time-entries", createTimeEntry)
+			r.Get("/dependencies", listTaskDependencies)
+			r.Post("/dependencies", addTaskDependency)
+			r.Delete("/dependencies/{blockedByID}", removeTaskDependency)
+			r.Get("/comments", listTaskComments)
+			r.Post("/comments", createTaskComment)
+			r.Get("/activity", listTaskActivity)
+			r.Get("/notes", listTaskNotes)
 		})
 	})
 
+	// Comment routes
+	r.Route("/comments/{commentID}", func(r chi.Router) {
+		r.Put("/", updateComment)
+		r.Delete("/", deleteComment)
+	})
+
+	// Time tracking routes
+	r.Get("/timer", getRunningTimer)
+	r.Delete("/time-entries/{entryID}", deleteTimeEntry)
+
 	// Project routes
 	r.Route("/projects", func(r chi.Router) {
 		r.Get("/", listProjects)
 		r.Post("/", createProject)
+		r.Get("/inbox", getInboxProject)
 		r.Route("/{projectID}", func(r chi.Router) {
 			r.Put("/tasks/reorder", reorderTasks)
 			r.Put("/", updateProject)
 			r.Delete("/", deleteProject)
+			r.Post("/archive", archiveProject)
+			r.Post("/unarchive", unarchiveProject)
+			r.Get("/comments", listProjectComments)
+			r.Post("/comments", createProjectComment)
+			r.Get("/activity", listProjectActivity)
 		})
 	})
 
@@ -96,14 +137,107 @@ func main() {
 		r.Route("/{noteID}", func(r chi.Router) {
 			r.Put("/", updateNote)
 			r.Delete("/", deleteNote)
+			r.Get("/activity", listNoteActivity)
+			r.Get("/tasks", listNoteTasks)
+			r.Post("/tasks", linkNoteTask)
+			r.Delete("/tasks/{taskID}", unlinkNoteTask)
+			r.Post("/convert", convertNote)
+			r.Get("/revisions", listNoteRevisions)
+			r.Get("/revisions/{revisionID}/diff", diffNoteRevision)
+			r.Post("/revisions/{revisionID}/restore", restoreNoteRevision)
+		})
+	})
+
+	// Note folder routes
+	r.Route("/folders", func(r chi.Router) {
+		r.Get("/", listFolders)
+		r.Post("/", createFolder)
+		r.Route("/{folderID}", func(r chi.Router) {
+			r.Put("/", updateFolder)
+			r.Delete("/", deleteFolder)
 		})
 	})
 
 	// AI routes
 	r.Route("/ai", func(r chi.Router) {
 		r.Post("/audio", transcribeAudio)
+		r.Post("/command", runAICommand)
+		r.Route("/conversations", func(r chi.Router) {
+			r.Get("/", listConversations)
+			r.Post("/", createConversation)
+			r.Route("/{conversationID}", func(r chi.Router) {
+				r.Get("/", getConversation)
+				r.Put("/", updateConversation)
+				r.Delete("/", deleteConversation)
+				r.Post("/messages", sendConversationMessage)
+			})
+		})
+		r.Route("/plans", func(r chi.Router) {
+			r.Get("/", listPlans)
+			r.Route("/{planID}", func(r chi.Router) {
+				r.Get("/", getPlan)
+				r.Post("/approve", approvePlan)
+				r.Post("/reject", rejectPlan)
+			})
+		})
+	})
+
+	// Habit routes
+	r.Route("/habits", func(r chi.Router) {
+		r.Get("/", listHabits)
+		r.Route("/{taskID}", func(r chi.Router) {
+			r.Get("/stats", getHabitStats)
+			r.Post("/checkins", createHabitCheckIn)
+			r.Delete("/checkins/{date}", deleteHabitCheckIn)
+		})
 	})
 
+	// Focus session routes
+	r.Route("/focus", func(r chi.Router) {
+		r.Get("/", listFocusSessions)
+		r.Post("/", startFocusSession)
+		r.Get("/current", getCurrentFocusSession)
+		r.Route("/{sessionID}", func(r chi.Router) {
+			r.Post("/pause", pauseFocusSession)
+			r.Post("/resume", resumeFocusSession)
+			r.Post("/abort", abortFocusSession)
+		})
+	})
+
+	// Statistics routes
+	r.Route("/stats", func(r chi.Router) {
+		r.Get("/", getStats)
+		r.Get("/digest", getWeeklyDigest)
+	})
+
+	// Goal routes
+	r.Route("/goals", func(r chi.Router) {
+		r.Get("/", listGoals)
+		r.Post("/", createGoal)
+		r.Route("/{goalID}", func(r chi.Router) {
+			r.Get("/", getGoal)
+			r.Put("/", updateGoal)
+			r.Delete("/", deleteGoal)
+			r.Post("/checkins", createGoalCheckIn)
+			r.Delete("/checkins/{checkInID}", deleteGoalCheckIn)
+		})
+	})
+
+	// Trash routes
+	r.Route("/trash", func(r chi.Router) {
+		r.Get("/", listTrash)
+		r.Delete("/", emptyTrash)
+		r.Post("/tasks/{taskID}/restore", restoreTask)
+		r.Post("/projects/{projectID}/restore", restoreProject)
+		r.Post("/notes/{noteID}/restore", restoreNote)
+	})
+
+	// Search route
+	r.Get("/search", search)
+
+	// Activity log route
+	r.Get("/activity", listActivities)
+
 	// Sync route
 	r.Get("/sync", syncData)
 
@@ -117,14 +251,28 @@ func main() {
 func listTasks(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Listing tasks").Send()
 
+	query := database.DB.Preload("Project")
+	if !utils.QueryBool(r, "include_archived") {
+		query = query.Scopes(database.TasksInActiveProjects)
+	}
+	if utils.QueryBool(r, "actionable") {
+		query = query.Scopes(database.ActionableTasks)
+	}
+
 	var tasks []database.Task
-	result := database.DB.Preload("Project").Find(&tasks)
+	result := query.Find(&tasks)
 	if result.Error != nil {
 		logger.Error("Failed to retrieve tasks").Err(result.Error).Send()
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if err := database.FillBlocked(database.DB, tasks); err != nil {
+		logger.Error("Failed to retrieve task dependencies").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	logger.Info("Successfully retrieved tasks").Int64("count", result.RowsAffected).Send()
 	json.NewEncoder(w).Encode(tasks)
 }
@@ -140,27 +288,26 @@ func createTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate recurrence pattern
-	if err := utils.ValidateTaskRecurrence(t.Recurrence, t.DueDate, t.DueDatetime); err != nil {
-		logger.Error("Invalid task recurrence").Str("recurrence", t.Recurrence).Err(err).Send()
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// Set order if not provided
-	if t.Order == 0 {
-		var maxOrder int
-		database.DB.Model(&database.Task{}).Select("COALESCE(MAX(order), 0)").Where("project_id = ?", t.ProjectID).Scan(&maxOrder)
-		t.Order = maxOrder + 1
-	}
-
-	result := database.DB.Create(&t)
-	if result.Error != nil {
-		logger.Error("Failed to create task").Err(result.Error).Str("description", t.Description).Send()
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	if err := saveNewTask(database.DB, &t); err != nil {
+		var invalid invalidTaskError
+		switch {
+		case errors.As(err, &invalid):
+			logger.Error("Invalid task").Str("recurrence", t.Recurrence).Err(err).Send()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, errProjectNotFound):
+			logger.Error("Project not found").Uint("project_id", *t.ProjectID).Send()
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, errProjectArchived):
+			logger.Error("Refusing to add task to archived project").Uint("project_id", *t.ProjectID).Send()
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			logger.Error("Failed to create task").Err(err).Str("description", t.Description).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
+	recordActivity(r, database.ActivityEntityTask, t.ID, database.ActivityCreate, nil, t)
 	logger.Info("Successfully created task").Uint("task_id", t.ID).Str("description", t.Description).Send()
 	json.NewEncoder(w).Encode(t)
 }
@@ -188,6 +335,34 @@ func updateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := utils.ValidateHabit(t.IsHabit, t.Recurrence); err != nil {
+		logger.Error("Invalid habit").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var before database.Task
+	if !loadEntity(w, &before, id, "Task") {
+		return
+	}
+
+	// Tasks of archived projects are frozen, and can't be moved into one either
+	for _, projectID := range []*uint{before.ProjectID, t.ProjectID} {
+		if projectID == nil {
+			continue
+		}
+		if archived, err := isProjectArchived(database.DB, *projectID); err != nil {
+			logger.Error("Failed to check project").Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if archived {
+			logger.Error("Refusing to update task in archived project").Uint("task_id", id).Uint("project_id", *projectID).Send()
+			http.Error(w, errProjectArchived.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	t.DeletedAt = gorm.DeletedAt{}
 	result := database.DB.Model(&t).Where("id = ?", id).Select("*").Updates(t)
 	if result.Error != nil {
 		logger.Error("Failed to update task").Uint("task_id", id).Err(result.Error).Send()
@@ -195,6 +370,8 @@ func updateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordUpdate(r, database.ActivityEntityTask, id, database.ActivityUpdate, before, &database.Task{})
+
 	logger.Info("Successfully updated task").Uint("task_id", id).Send()
 	w.WriteHeader(http.StatusOK)
 }
@@ -207,6 +384,11 @@ func deleteTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var before database.Task
+	if !loadEntity(w, &before, id, "Task") {
+		return
+	}
+
 	result := database.DB.Delete(&database.Task{}, id)
 	if result.Error != nil {
 		logger.Error("Failed to delete task").Uint("task_id", id).Err(result.Error).Send()
@@ -214,6 +396,8 @@ func deleteTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordActivity(r, database.ActivityEntityTask, id, database.ActivityDelete, before, nil)
+
 	logger.Info("Successfully deleted task").Uint("task_id", id).Send()
 	w.WriteHeader(http.StatusOK)
 }
@@ -240,68 +424,61 @@ func completeTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	now := time.Now()
-	updates := map[string]any{
-		"completed_at": &now,
+	unblocked, err := markTaskComplete(database.DB, task)
+	if err != nil {
+		if errors.Is(err, errProjectArchived) {
+			logger.Error("Refusing to complete task in archived project").Uint("task_id", id).Send()
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		logger.Error("Failed to complete task").Uint("task_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// Handle recurring tasks
-	if task.Recurrence != "" {
-		// Calculate next due date/datetime
-		var currentDue *time.Time
-		if task.DueDatetime != nil {
-			currentDue = task.DueDatetime
-		} else if task.DueDate != nil {
-			currentDue = task.DueDate
-		}
+	recordUpdate(r, database.ActivityEntityTask, id, database.ActivityComplete, task, &database.Task{})
 
-		nextDue, err := utils.CalculateNextDueDate(task.Recurrence, currentDue)
-		if err != nil {
-			logger.Error("Failed to calculate next due date").Str("recurrence", task.Recurrence).Err(err).Send()
-			http.Error(w, fmt.Sprintf("Failed to calculate next due date: %s", err.Error()), http.StatusInternalServerError)
-			return
-		}
+	logger.Info("Successfully completed task").Uint("task_id", id).Int("unblocked", len(unblocked)).Send()
+	w.WriteHeader(http.StatusOK)
+}
 
-		if nextDue != nil {
-			// Update the appropriate due field
-			if task.DueDatetime != nil {
-				updates["due_datetime"] = nextDue
-			} else if task.DueDate != nil {
-				// For date-only, set to date part only
-				dateOnly := time.Date(nextDue.Year(), nextDue.Month(), nextDue.Day(), 0, 0, 0, 0, nextDue.Location())
-				updates["due_date"] = &dateOnly
-			}
-		}
+func listProjects(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing projects").Send()
 
-		// For recurring tasks, clear completed_at to keep them active
-		updates["completed_at"] = nil
-		logger.Info("Recurring task - updated due date and cleared completion").Uint("task_id", id).Send()
+	query := database.DB.Preload("Tasks")
+	if !utils.QueryBool(r, "include_archived") {
+		query = query.Scopes(database.ActiveProjects)
 	}
 
-	result = database.DB.Model(&task).Where("id = ?", id).Updates(updates)
+	var projects []database.Project
+	result := query.Find(&projects)
 	if result.Error != nil {
-		logger.Error("Failed to complete task").Uint("task_id", id).Err(result.Error).Send()
+		logger.Error("Failed to retrieve projects").Err(result.Error).Send()
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("Successfully completed task").Uint("task_id", id).Send()
-	w.WriteHeader(http.StatusOK)
+	logger.Info("Successfully retrieved projects").Int64("count", result.RowsAffected).Send()
+	if utils.QueryBool(r, "flat") {
+		json.NewEncoder(w).Encode(projects)
+		return
+	}
+	json.NewEncoder(w).Encode(database.BuildProjectTree(projects, time.Now()))
 }
 
-func listProjects(w http.ResponseWriter, r *http.Request) {
-	logger.Info("Listing projects").Send()
+func getInboxProject(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Getting Inbox project").Send()
 
-	var projects []database.Project
-	result := database.DB.Preload("Tasks").Find(&projects)
+	var inbox database.Project
+	result := database.DB.Where("id = ?", database.InboxProjectID).First(&inbox)
 	if result.Error != nil {
-		logger.Error("Failed to retrieve projects").Err(result.Error).Send()
+		logger.Error("Failed to retrieve Inbox project").Err(result.Error).Send()
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("Successfully retrieved projects").Int64("count", result.RowsAffected).Send()
-	json.NewEncoder(w).Encode(projects)
+	logger.Info("Successfully retrieved Inbox project").Uint("project_id", inbox.ID).Send()
+	json.NewEncoder(w).Encode(inbox)
 }
 
 func createProject(w http.ResponseWriter, r *http.Request) {
@@ -315,10 +492,21 @@ func createProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set order if not provided
+	// Only InitDB may create the system Inbox project
+	p.IsInbox = false
+	p.DeletedAt = gorm.DeletedAt{}
+
+	if p.ParentID != nil {
+		if err := database.ValidateProjectParent(database.DB, 0, *p.ParentID); err != nil {
+			writeParentError(w, err)
+			return
+		}
+	}
+
+	// Set order if not provided, placing the project after its siblings
 	if p.Order == 0 {
 		var maxOrder int
-		database.DB.Model(&database.Project{}).Select("COALESCE(MAX(order), 0)").Scan(&maxOrder)
+		database.DB.Model(&database.Project{}).Select(`COALESCE(MAX("order"), 0)`).Where("parent_id IS NOT DISTINCT FROM ?", p.ParentID).Scan(&maxOrder)
 		p.Order = maxOrder + 1
 	}
 
@@ -329,6 +517,7 @@ func createProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordActivity(r, database.ActivityEntityProject, p.ID, database.ActivityCreate, nil, p)
 	logger.Info("Successfully created project").Uint("project_id", p.ID).Str("name", p.Name).Send()
 	json.NewEncoder(w).Encode(p)
 }
@@ -341,25 +530,89 @@ func updateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var p database.Project
-	err := json.NewDecoder(r.Body).Decode(&p)
+	var body json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		logger.Error("Failed to decode project update request").Err(err).Send()
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	result := database.DB.Model(&p).Where("id = ?", id).Updates(p)
-	if result.Error != nil {
-		logger.Error("Failed to update project").Uint("project_id", id).Err(result.Error).Send()
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	var p database.Project
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &p); err != nil {
+		logger.Error("Failed to decode project update request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		logger.Error("Failed to decode project update request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The Inbox flag can't be moved and the Inbox can't be renamed.
+	// Archiving goes through its own endpoints.
+	p.IsInbox = false
+	p.ArchivedAt = nil
+	p.DeletedAt = gorm.DeletedAt{}
+	if id == database.InboxProjectID && p.Name != "" && p.Name != database.InboxProjectName {
+		logger.Error("Refusing to rename Inbox project").Uint("project_id", id).Str("name", p.Name).Send()
+		http.Error(w, "Inbox project can't be renamed", http.StatusForbidden)
+		return
+	}
+
+	// parent_id is only changed when present in the body, so null moves a project to the top level
+	_, moveProject := fields["parent_id"]
+	parentID := p.ParentID
+	p.ParentID = nil
+	if moveProject && parentID != nil {
+		if id == database.InboxProjectID {
+			logger.Error("Refusing to nest Inbox project").Uint("project_id", id).Send()
+			http.Error(w, "Inbox project can't be nested", http.StatusForbidden)
+			return
+		}
+		if err := database.ValidateProjectParent(database.DB, id, *parentID); err != nil {
+			writeParentError(w, err)
+			return
+		}
+	}
+
+	var before database.Project
+	if !loadEntity(w, &before, id, "Project") {
 		return
 	}
 
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&p).Where("id = ?", id).Updates(p).Error; err != nil {
+			return err
+		}
+		if moveProject {
+			return tx.Model(&database.Project{}).Where("id = ?", id).Update("parent_id", parentID).Error
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to update project").Uint("project_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recordUpdate(r, database.ActivityEntityProject, id, database.ActivityUpdate, before, &database.Project{})
 	logger.Info("Successfully updated project").Uint("project_id", id).Send()
 	w.WriteHeader(http.StatusOK)
 }
 
+// Project deletion modes, selected with the "mode" query parameter
+const (
+	deleteModeRefuse  = "refuse"
+	deleteModeCascade = "cascade"
+	deleteModeMove    = "move"
+)
+
+// errProjectNotEmpty is returned when a non-empty project is deleted in refuse mode
+var errProjectNotEmpty = errors.New("project still has tasks")
+
 func deleteProject(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Deleting project").Send()
 
@@ -368,17 +621,278 @@ func deleteProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := database.DB.Delete(&database.Project{}, id)
+	if id == database.InboxProjectID {
+		logger.Error("Refusing to delete Inbox project").Uint("project_id", id).Send()
+		http.Error(w, "Inbox project can't be deleted", http.StatusForbidden)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = deleteModeRefuse
+	}
+	if mode != deleteModeRefuse && mode != deleteModeCascade && mode != deleteModeMove {
+		logger.Error("Invalid project delete mode").Str("mode", mode).Send()
+		http.Error(w, "mode must be one of: refuse, cascade, move", http.StatusBadRequest)
+		return
+	}
+
+	var project database.Project
+	result := database.DB.Where("id = ?", id).First(&project)
 	if result.Error != nil {
-		logger.Error("Failed to delete project").Uint("project_id", id).Err(result.Error).Send()
+		if result.Error == gorm.ErrRecordNotFound {
+			logger.Error("Project not found").Uint("project_id", id).Send()
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to fetch project").Uint("project_id", id).Err(result.Error).Send()
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("Successfully deleted project").Uint("project_id", id).Send()
+	var tasks []database.Task
+	if mode != deleteModeRefuse {
+		if err := database.DB.Where("project_id = ?", id).Find(&tasks).Error; err != nil {
+			logger.Error("Failed to fetch project tasks").Uint("project_id", id).Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Tasks trashed with the project share its deletion time so they're restored with it
+	deletedAt := time.Now()
+	var affected int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Subprojects move up to the deleted project's parent until it's restored
+		err := tx.Model(&database.Project{}).Where("parent_id = ?", id).
+			Updates(map[string]any{"parent_id": project.ParentID, "trashed_parent_id": id}).Error
+		if err != nil {
+			return err
+		}
+
+		switch mode {
+		case deleteModeCascade:
+			result := tx.Model(&database.Task{}).Where("project_id = ?", id).Update("deleted_at", deletedAt)
+			if result.Error != nil {
+				return result.Error
+			}
+			affected = result.RowsAffected
+		case deleteModeMove:
+			var maxOrder int
+			if err := tx.Model(&database.Task{}).Select(`COALESCE(MAX("order"), 0)`).Where("project_id = ?", database.InboxProjectID).Scan(&maxOrder).Error; err != nil {
+				return err
+			}
+			result := tx.Model(&database.Task{}).Where("project_id = ?", id).
+				Updates(map[string]any{
+					"project_id": database.InboxProjectID,
+					"order":      gorm.Expr(`"order" + ?`, maxOrder),
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			affected = result.RowsAffected
+		default:
+			if err := tx.Model(&database.Task{}).Where("project_id = ?", id).Count(&affected).Error; err != nil {
+				return err
+			}
+			if affected > 0 {
+				return errProjectNotEmpty
+			}
+		}
+
+		return tx.Model(&project).Update("deleted_at", deletedAt).Error
+	})
+	if err != nil {
+		if errors.Is(err, errProjectNotEmpty) {
+			logger.Error("Refusing to delete non-empty project").Uint("project_id", id).Int64("tasks", affected).Send()
+			http.Error(w, fmt.Sprintf("Project has %d tasks; use mode=cascade or mode=move", affected), http.StatusConflict)
+			return
+		}
+		logger.Error("Failed to delete project").Uint("project_id", id).Str("mode", mode).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recordActivity(r, database.ActivityEntityProject, id, database.ActivityDelete, project, nil)
+	for _, task := range tasks {
+		if mode == deleteModeCascade {
+			recordActivity(r, database.ActivityEntityTask, task.ID, database.ActivityDelete, task, nil)
+		} else {
+			recordUpdate(r, database.ActivityEntityTask, task.ID, database.ActivityUpdate, task, &database.Task{})
+		}
+	}
+
+	logger.Info("Successfully deleted project").Uint("project_id", id).Str("mode", mode).Int64("tasks", affected).Send()
 	w.WriteHeader(http.StatusOK)
 }
 
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func writeParentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrProjectCycle) {
+		logger.Error("Invalid project parent").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == gorm.ErrRecordNotFound {
+		logger.Error("Parent project not found").Send()
+		http.Error(w, "Parent project not found", http.StatusBadRequest)
+		return
+	}
+	logger.Error("Failed to validate project parent").Err(err).Send()
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func isProjectArchived(db *gorm.DB, id uint) (bool, error) {
+	var count int64
+	err := db.Model(&database.Project{}).Where("id = ? AND archived_at IS NOT NULL", id).Count(&count).Error
+	return count > 0, err
+}
+
+func archiveProject(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Archiving project").Send()
+
+	id, ok := utils.ParseProjectID(r, w)
+	if !ok {
+		return
+	}
+
+	if id == database.InboxProjectID {
+		logger.Error("Refusing to archive Inbox project").Uint("project_id", id).Send()
+		http.Error(w, "Inbox project can't be archived", http.StatusForbidden)
+		return
+	}
+
+	var before database.Project
+	if !loadEntity(w, &before, id, "Project") {
+		return
+	}
+
+	now := time.Now()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Project{}).Where("id = ? AND archived_at IS NULL", id).Update("archived_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		// Touch tasks so incremental sync lists them as archived
+		return tx.Model(&database.Task{}).Where("project_id = ?", id).Update("updated_at", now).Error
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logger.Error("Project not found or already archived").Uint("project_id", id).Send()
+			http.Error(w, "Project not found or already archived", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to archive project").Uint("project_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recordUpdate(r, database.ActivityEntityProject, id, database.ActivityArchive, before, &database.Project{})
+	logger.Info("Successfully archived project").Uint("project_id", id).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+func unarchiveProject(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Unarchiving project").Send()
+
+	id, ok := utils.ParseProjectID(r, w)
+	if !ok {
+		return
+	}
+
+	var before database.Project
+	if !loadEntity(w, &before, id, "Project") {
+		return
+	}
+
+	now := time.Now()
+	var tasks []database.Task
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Project{}).Where("id = ? AND archived_at IS NOT NULL", id).Update("archived_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Where("project_id = ?", id).Find(&tasks).Error; err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			if err := tx.Model(&task).Updates(thawTaskUpdates(task, now)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logger.Error("Project not found or not archived").Uint("project_id", id).Send()
+			http.Error(w, "Project not found or not archived", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to unarchive project").Uint("project_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recordUpdate(r, database.ActivityEntityProject, id, database.ActivityUnarchive, before, &database.Project{})
+	// Thawed tasks may have lost past reminders or skipped missed occurrences
+	for _, task := range tasks {
+		recordUpdate(r, database.ActivityEntityTask, task.ID, database.ActivityUnarchive, task, &database.Task{})
+	}
+
+	logger.Info("Successfully unarchived project").Uint("project_id", id).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+// thawTaskUpdates builds the updates that resume a task after its project was archived:
+// reminders that passed while frozen are dropped and recurring tasks skip the
+// occurrences they missed instead of coming back overdue.
+func thawTaskUpdates(task database.Task, now time.Time) map[string]any {
+	updates := map[string]any{
+		"updated_at": now,
+	}
+
+	if len(task.Reminders) > 0 {
+		reminders := database.TimeArray{}
+		for _, reminder := range task.Reminders {
+			if reminder.After(now) {
+				reminders = append(reminders, reminder)
+			}
+		}
+		updates["reminders"] = reminders
+	}
+
+	if task.Recurrence == "" || task.CompletedAt != nil {
+		return updates
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if task.DueDatetime != nil && task.DueDatetime.Before(now) {
+		if next := utils.NextOccurrenceAfter(task.Recurrence, *task.DueDatetime, now); next != nil {
+			updates["due_datetime"] = next
+		}
+	} else if task.DueDate != nil && task.DueDate.Before(today) {
+		if next := utils.NextOccurrenceAfter(task.Recurrence, *task.DueDate, today.Add(-time.Nanosecond)); next != nil {
+			dateOnly := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, next.Location())
+			updates["due_date"] = &dateOnly
+		}
+	}
+
+	return updates
+}
+
 func updateOrderBatch(model any, ids []uint, whereClause string, whereArgs ...any) error {
 	for i, id := range ids {
 		var result *gorm.DB
@@ -405,6 +919,29 @@ func reorderProjects(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Order is relative to siblings, so all projects must share a parent
+	var parentIDs []*uint
+	err = database.DB.Model(&database.Project{}).Where("id IN ?", projectIDs).Pluck("parent_id", &parentIDs).Error
+	if err != nil {
+		logger.Error("Failed to fetch project parents").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, parentID := range parentIDs {
+		if !sameParent(parentID, parentIDs[0]) {
+			logger.Error("Refusing to reorder projects with different parents").Interface("project_ids", projectIDs).Send()
+			http.Error(w, "Projects must share the same parent", http.StatusBadRequest)
+			return
+		}
+	}
+
+	previous, err := currentOrders(database.DB.Model(&database.Project{}), projectIDs)
+	if err != nil {
+		logger.Error("Failed to fetch project order").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	err = updateOrderBatch(&database.Project{}, projectIDs, "", nil)
 	if err != nil {
 		logger.Error("Failed to reorder projects").Err(err).Send()
@@ -412,6 +949,8 @@ func reorderProjects(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordReorder(r, database.ActivityEntityProject, projectIDs, previous)
+
 	logger.Info("Successfully reordered projects").Int("count", len(projectIDs)).Send()
 	w.WriteHeader(http.StatusOK)
 }
@@ -433,6 +972,13 @@ func reorderTasks(w http.ResponseWriter, r *http.Request) {
 	}
 	logger.Info("Task IDs").Interface("task_ids", taskIDs).Send()
 
+	previous, err := currentOrders(database.DB.Model(&database.Task{}).Where("project_id = ?", id), taskIDs)
+	if err != nil {
+		logger.Error("Failed to fetch task order").Uint("project_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	err = updateOrderBatch(&database.Task{}, taskIDs, "project_id = ?", id)
 	if err != nil {
 		logger.Error("Failed to reorder tasks").Uint("project_id", id).Err(err).Send()
@@ -440,14 +986,25 @@ func reorderTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordReorder(r, database.ActivityEntityTask, taskIDs, previous)
+
 	logger.Info("Successfully reordered tasks").Uint("project_id", id).Int("count", len(taskIDs)).Send()
 	w.WriteHeader(http.StatusOK)
 }
 
+// SyncResponse holds what changed since the sync token. Without include_archived,
+// archived projects and their tasks are left out; the IDs of those archived or
+// changed since the token are listed instead, and clients must drop them, together
+// with their reminders.
 type SyncResponse struct {
-	Projects  []database.Project `json:"projects"`
-	Tasks     []database.Task    `json:"tasks"`
-	SyncToken string             `json:"sync_token"`
+	Projects           []database.Project     `json:"projects"`
+	Tasks              []database.Task        `json:"tasks"`
+	ArchivedProjectIDs []uint                 `json:"archived_project_ids"`
+	ArchivedTaskIDs    []uint                 `json:"archived_task_ids"`
+	Goals              []database.Goal        `json:"goals"`
+	Comments           []database.Comment     `json:"comments"`
+	FocusSession       *database.FocusSession `json:"focus_session"`
+	SyncToken          string                 `json:"sync_token"`
 }
 
 func syncData(w http.ResponseWriter, r *http.Request) {
@@ -471,8 +1028,13 @@ func syncData(w http.ResponseWriter, r *http.Request) {
 		logger.Info("Syncing from timestamp").Time("sync_time", syncTime).Send()
 	}
 	
+	includeArchived := utils.QueryBool(r, "include_archived")
+
 	// Query projects modified after sync token
 	projectQuery := database.DB.Preload("Tasks")
+	if !includeArchived {
+		projectQuery = projectQuery.Scopes(database.ActiveProjects)
+	}
 	if syncToken != "" {
 		projectQuery = projectQuery.Where("updated_at > ?", syncTime)
 	}
@@ -486,6 +1048,9 @@ func syncData(w http.ResponseWriter, r *http.Request) {
 	
 	// Query tasks modified after sync token
 	taskQuery := database.DB.Preload("Project")
+	if !includeArchived {
+		taskQuery = taskQuery.Scopes(database.TasksInActiveProjects)
+	}
 	if syncToken != "" {
 		taskQuery = taskQuery.Where("updated_at > ?", syncTime)
 	}
@@ -496,19 +1061,99 @@ func syncData(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
-	
+
+	if err := database.FillBlocked(database.DB, tasks); err != nil {
+		logger.Error("Failed to retrieve task dependencies").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Tell clients which projects and tasks were archived, so they drop them
+	archivedProjectIDs := []uint{}
+	archivedTaskIDs := []uint{}
+	if !includeArchived && syncToken != "" {
+		err := database.DB.Model(&database.Project{}).
+			Where("archived_at IS NOT NULL AND updated_at > ?", syncTime).
+			Pluck("id", &archivedProjectIDs).Error
+		if err == nil {
+			err = database.DB.Model(&database.Task{}).
+				Where("updated_at > ?", syncTime).
+				Where("EXISTS (SELECT 1 FROM projects WHERE projects.id = tasks.project_id AND projects.archived_at IS NOT NULL)").
+				Pluck("id", &archivedTaskIDs).Error
+		}
+		if err != nil {
+			logger.Error("Failed to retrieve archived items").Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Query goals modified after sync token
+	var goals []database.Goal
+	goalQuery := database.DB.Scopes(database.PreloadGoal)
+	if syncToken != "" {
+		goalQuery = goalQuery.Where("updated_at > ?", syncTime)
+	}
+
+	result = goalQuery.Find(&goals)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve goals").Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	for i := range goals {
+		goals[i].ComputeProgress(now)
+	}
+
+	// Query comments modified after sync token
+	var comments []database.Comment
+	commentQuery := database.DB.Order("created_at, id")
+	if syncToken != "" {
+		commentQuery = commentQuery.Where("updated_at > ?", syncTime)
+	}
+
+	result = commentQuery.Find(&comments)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve comments").Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The focus session is always sent in full so every device shows the same timer
+	var focusSession *database.FocusSession
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		focusSession, err = loadActiveFocusSession(tx)
+		return err
+	})
+	if err != nil {
+		logger.Error("Failed to retrieve focus session").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Generate new sync token (current timestamp)
-	newSyncToken := time.Now().Format(time.RFC3339)
-	
+	newSyncToken := now.Format(time.RFC3339)
+
 	response := SyncResponse{
-		Projects:  projects,
-		Tasks:     tasks,
-		SyncToken: newSyncToken,
+		Projects:           projects,
+		Tasks:              tasks,
+		ArchivedProjectIDs: archivedProjectIDs,
+		ArchivedTaskIDs:    archivedTaskIDs,
+		Goals:              goals,
+		Comments:           comments,
+		FocusSession:       focusSession,
+		SyncToken:          newSyncToken,
 	}
-	
+
 	logger.Info("Successfully synced data").
 		Int("projects", len(projects)).
 		Int("tasks", len(tasks)).
+		Int("archived_tasks", len(archivedTaskIDs)).
+		Int("goals", len(goals)).
+		Int("comments", len(comments)).
 		Str("new_sync_token", newSyncToken).
 		Send()
 	
@@ -519,8 +1164,20 @@ func syncData(w http.ResponseWriter, r *http.Request) {
 func listNotes(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Listing notes").Send()
 
+	// Pinned notes come first, then the most recently edited
+	query := database.DB.Order("pinned DESC, updated_at DESC")
+	if folderID := r.URL.Query().Get("folder_id"); folderID != "" {
+		query = query.Where("folder_id = ?", folderID)
+	}
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		query = query.Where("? = ANY(tags)", tag)
+	}
+	if utils.QueryBool(r, "pinned") {
+		query = query.Where("pinned = ?", true)
+	}
+
 	var notes []database.Note
-	result := database.DB.Find(&notes)
+	result := query.Find(&notes)
 	if result.Error != nil {
 		logger.Error("Failed to retrieve notes").Err(result.Error).Send()
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
@@ -528,6 +1185,14 @@ func listNotes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logger.Info("Successfully retrieved notes").Int64("count", result.RowsAffected).Send()
+	if utils.QueryBool(r, "summary") {
+		summaries := make([]database.NoteSummary, 0, len(notes))
+		for _, n := range notes {
+			summaries = append(summaries, n.Summary())
+		}
+		json.NewEncoder(w).Encode(summaries)
+		return
+	}
 	json.NewEncoder(w).Encode(notes)
 }
 
@@ -542,6 +1207,16 @@ func createNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	n.DeletedAt = gorm.DeletedAt{}
+	n.Tags = database.NormalizeTags(n.Tags)
+	if n.FolderID != nil {
+		if err := checkIDsExist(&database.Folder{}, []uint{*n.FolderID}); err != nil {
+			logger.Error("Invalid note folder").Uint("folder_id", *n.FolderID).Err(err).Send()
+			http.Error(w, "Folder not found", http.StatusBadRequest)
+			return
+		}
+	}
+
 	result := database.DB.Create(&n)
 	if result.Error != nil {
 		logger.Error("Failed to create note").Err(result.Error).Str("title", n.Title).Send()
@@ -549,6 +1224,7 @@ func createNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordActivity(r, database.ActivityEntityNote, n.ID, database.ActivityCreate, nil, n)
 	logger.Info("Successfully created note").Uint("note_id", n.ID).Str("title", n.Title).Send()
 	json.NewEncoder(w).Encode(n)
 }
@@ -561,21 +1237,79 @@ func updateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var n database.Note
-	err := json.NewDecoder(r.Body).Decode(&n)
+	var body json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		logger.Error("Failed to decode note update request").Err(err).Send()
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	result := database.DB.Model(&n).Where("id = ?", id).Updates(n)
-	if result.Error != nil {
-		logger.Error("Failed to update note").Uint("note_id", id).Err(result.Error).Send()
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	var n database.Note
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &n); err != nil {
+		logger.Error("Failed to decode note update request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		logger.Error("Failed to decode note update request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	var before database.Note
+	if !loadEntity(w, &before, id, "Note") {
+		return
+	}
+
+	// Tags, pinning and the folder are only changed when present in the body, so they
+	// can be cleared with an empty list, false or null
+	updates := map[string]any{}
+	if _, ok := fields["tags"]; ok {
+		updates["tags"] = database.NormalizeTags(n.Tags)
+	}
+	if _, ok := fields["pinned"]; ok {
+		updates["pinned"] = n.Pinned
+	}
+	if _, ok := fields["folder_id"]; ok {
+		if n.FolderID != nil {
+			if err := checkIDsExist(&database.Folder{}, []uint{*n.FolderID}); err != nil {
+				logger.Error("Invalid note folder").Uint("folder_id", *n.FolderID).Err(err).Send()
+				http.Error(w, "Folder not found", http.StatusBadRequest)
+				return
+			}
+		}
+		updates["folder_id"] = n.FolderID
+	}
+	n.Tags = nil
+	n.Pinned = false
+	n.FolderID = nil
+	n.DeletedAt = gorm.DeletedAt{}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&n).Where("id = ?", id).Updates(n).Error; err != nil {
+			return err
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&database.Note{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		var after database.Note
+		if err := tx.Where("id = ?", id).First(&after).Error; err != nil {
+			return err
+		}
+		return database.SaveRevision(tx, before, after)
+	})
+	if err != nil {
+		logger.Error("Failed to update note").Uint("note_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recordUpdate(r, database.ActivityEntityNote, id, database.ActivityUpdate, before, &database.Note{})
+
 	logger.Info("Successfully updated note").Uint("note_id", id).Send()
 	w.WriteHeader(http.StatusOK)
 }
@@ -588,6 +1322,11 @@ func deleteNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var before database.Note
+	if !loadEntity(w, &before, id, "Note") {
+		return
+	}
+
 	result := database.DB.Delete(&database.Note{}, id)
 	if result.Error != nil {
 		logger.Error("Failed to delete note").Uint("note_id", id).Err(result.Error).Send()
@@ -595,6 +1334,8 @@ func deleteNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordActivity(r, database.ActivityEntityNote, id, database.ActivityDelete, before, nil)
+
 	logger.Info("Successfully deleted note").Uint("note_id", id).Send()
 	w.WriteHeader(http.StatusOK)
 }
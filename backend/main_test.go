@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+)
+
+// testDB connects to the Postgres database in TEST_DATABASE_URL and migrates it, or
+// skips the test when it isn't set. Tests write to it, so use a database of its own.
+func testDB(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	testDBOnce.Do(func() {
+		testDBErr = database.InitDB(url)
+	})
+	if testDBErr != nil {
+		t.Fatalf("InitDB: %v", testDBErr)
+	}
+}
+
+// createTestProject creates a project with the given number of tasks. They are
+// removed for good when the test ends, wherever they were moved.
+func createTestProject(t *testing.T, tasks int) (database.Project, []uint) {
+	t.Helper()
+	project := database.Project{Name: fmt.Sprintf("%s project", t.Name())}
+	if err := database.DB.Create(&project).Error; err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	var ids []uint
+	for i := 0; i < tasks; i++ {
+		task := database.Task{Description: fmt.Sprintf("%s task %d", t.Name(), i+1), ProjectID: &project.ID, Order: i + 1}
+		if err := database.DB.Create(&task).Error; err != nil {
+			t.Fatalf("create task: %v", err)
+		}
+		ids = append(ids, task.ID)
+	}
+
+	t.Cleanup(func() {
+		if len(ids) > 0 {
+			database.DB.Unscoped().Delete(&database.Task{}, ids)
+		}
+		database.DB.Unscoped().Delete(&database.Project{}, project.ID)
+	})
+	return project, ids
+}
+
+func deleteTestProject(t *testing.T, id uint, mode string) *httptest.ResponseRecorder {
+	t.Helper()
+	router := chi.NewRouter()
+	router.Delete("/projects/{projectID}", deleteProject)
+
+	url := fmt.Sprintf("/projects/%d", id)
+	if mode != "" {
+		url += "?mode=" + mode
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, url, nil))
+	return w
+}
+
+func TestDeleteProjectRefusesWithTasks(t *testing.T) {
+	testDB(t)
+	project, ids := createTestProject(t, 2)
+
+	for _, mode := range []string{"", deleteModeRefuse} {
+		w := deleteTestProject(t, project.ID, mode)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("mode %q: got status %d, want 409: %s", mode, w.Code, w.Body)
+		}
+	}
+
+	var count int64
+	database.DB.Model(&database.Project{}).Where("id = ?", project.ID).Count(&count)
+	if count != 1 {
+		t.Error("project was deleted")
+	}
+	database.DB.Model(&database.Task{}).Where("id IN ? AND project_id = ?", ids, project.ID).Count(&count)
+	if count != int64(len(ids)) {
+		t.Errorf("got %d tasks left in the project, want %d", count, len(ids))
+	}
+}
+
+func TestDeleteProjectRefuseDeletesEmptyProject(t *testing.T) {
+	testDB(t)
+	project, _ := createTestProject(t, 0)
+
+	if w := deleteTestProject(t, project.ID, deleteModeRefuse); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body)
+	}
+
+	var trashed database.Project
+	if err := database.DB.Unscoped().Where("id = ?", project.ID).First(&trashed).Error; err != nil {
+		t.Fatalf("load project: %v", err)
+	}
+	if !trashed.DeletedAt.Valid {
+		t.Error("project isn't in the trash")
+	}
+}
+
+func TestDeleteProjectCascade(t *testing.T) {
+	testDB(t)
+	project, ids := createTestProject(t, 3)
+
+	if w := deleteTestProject(t, project.ID, deleteModeCascade); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body)
+	}
+
+	var trashed database.Project
+	if err := database.DB.Unscoped().Where("id = ?", project.ID).First(&trashed).Error; err != nil {
+		t.Fatalf("load project: %v", err)
+	}
+	var tasks []database.Task
+	if err := database.DB.Unscoped().Where("id IN ?", ids).Find(&tasks).Error; err != nil {
+		t.Fatalf("load tasks: %v", err)
+	}
+	if len(tasks) != len(ids) {
+		t.Fatalf("got %d tasks, want %d kept in the trash", len(tasks), len(ids))
+	}
+	for _, task := range tasks {
+		// Trashed with the project, so they're restored with it
+		if !task.DeletedAt.Valid || !task.DeletedAt.Time.Equal(trashed.DeletedAt.Time) {
+			t.Errorf("task %d: got deleted_at %v, want the project's %v", task.ID, task.DeletedAt, trashed.DeletedAt)
+		}
+		if task.ProjectID == nil || *task.ProjectID != project.ID {
+			t.Errorf("task %d left the project", task.ID)
+		}
+	}
+}
+
+func TestDeleteProjectMoveToInbox(t *testing.T) {
+	testDB(t)
+	project, ids := createTestProject(t, 2)
+
+	var inboxOrder int
+	database.DB.Model(&database.Task{}).Select(`COALESCE(MAX("order"), 0)`).Where("project_id = ?", database.InboxProjectID).Scan(&inboxOrder)
+
+	if w := deleteTestProject(t, project.ID, deleteModeMove); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body)
+	}
+
+	var tasks []database.Task
+	if err := database.DB.Where("id IN ?", ids).Order(`"order"`).Find(&tasks).Error; err != nil {
+		t.Fatalf("load tasks: %v", err)
+	}
+	if len(tasks) != len(ids) {
+		t.Fatalf("got %d active tasks, want %d", len(tasks), len(ids))
+	}
+	for i, task := range tasks {
+		if task.ProjectID == nil || *task.ProjectID != database.InboxProjectID {
+			t.Errorf("task %d: got project %v, want the Inbox", task.ID, task.ProjectID)
+		}
+		// Appended after the Inbox's tasks, in their old order
+		if want := inboxOrder + i + 1; task.Order != want {
+			t.Errorf("task %d: got order %d, want %d", task.ID, task.Order, want)
+		}
+	}
+
+	var count int64
+	database.DB.Model(&database.Project{}).Where("id = ?", project.ID).Count(&count)
+	if count != 0 {
+		t.Error("project wasn't deleted")
+	}
+}
+
+func TestDeleteProjectRejectsInboxAndUnknownMode(t *testing.T) {
+	testDB(t)
+	project, _ := createTestProject(t, 0)
+
+	if w := deleteTestProject(t, database.InboxProjectID, deleteModeCascade); w.Code != http.StatusForbidden {
+		t.Errorf("Inbox: got status %d, want 403", w.Code)
+	}
+	if w := deleteTestProject(t, project.ID, "purge"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown mode: got status %d, want 400", w.Code)
+	}
+}
+
+// The foreign key keeps a project from being removed for good while tasks, trashed
+// ones included, still belong to it
+func TestProjectForeignKeyRestrictsDelete(t *testing.T) {
+	testDB(t)
+	project, ids := createTestProject(t, 1)
+
+	if err := database.DB.Delete(&database.Task{}, ids).Error; err != nil {
+		t.Fatalf("trash task: %v", err)
+	}
+	err := database.DB.Unscoped().Delete(&database.Project{}, project.ID).Error
+	if err == nil || !strings.Contains(err.Error(), "SQLSTATE 23503") {
+		t.Fatalf("got error %v, want a foreign key violation", err)
+	}
+
+	database.DB.Unscoped().Delete(&database.Task{}, ids)
+	if err := database.DB.Unscoped().Delete(&database.Project{}, project.ID).Error; err != nil {
+		t.Errorf("delete empty project: %v", err)
+	}
+}
+
+func TestRestoreProjectTakesBackSubprojects(t *testing.T) {
+	testDB(t)
+	parent, _ := createTestProject(t, 0)
+	project, _ := createTestProject(t, 0)
+	child := database.Project{Name: t.Name() + " subproject", ParentID: &project.ID}
+	if err := database.DB.Create(&child).Error; err != nil {
+		t.Fatalf("create subproject: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Unscoped().Delete(&database.Project{}, child.ID) })
+	database.DB.Model(&project).Update("parent_id", parent.ID)
+
+	if w := deleteTestProject(t, project.ID, deleteModeRefuse); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body)
+	}
+	database.DB.Where("id = ?", child.ID).First(&child)
+	if child.ParentID == nil || *child.ParentID != parent.ID {
+		t.Fatalf("subproject got parent %v, want %d", child.ParentID, parent.ID)
+	}
+
+	if _, err := database.RestoreProject(database.DB, project.ID); err != nil {
+		t.Fatalf("RestoreProject: %v", err)
+	}
+	database.DB.Where("id = ?", child.ID).First(&child)
+	if child.ParentID == nil || *child.ParentID != project.ID {
+		t.Errorf("subproject got parent %v, want %d", child.ParentID, project.ID)
+	}
+	if child.TrashedParentID != nil {
+		t.Errorf("subproject still remembers trashed parent %d", *child.TrashedParentID)
+	}
+}
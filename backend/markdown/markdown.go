@@ -0,0 +1,143 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Heading is a Markdown heading in document order
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// Checklist counts the task list items of a document
+type Checklist struct {
+	Total int `json:"total"`
+	Done  int `json:"done"`
+}
+
+var (
+	headingPattern    = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	checkboxPattern   = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+\[([ xX])\]\s*(.*)$`)
+	listPattern       = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+`)
+	quotePattern      = regexp.MustCompile(`^\s*>\s?`)
+	fencePattern      = regexp.MustCompile("^\\s*(```|~~~)")
+	imagePattern      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	linkPattern       = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	emphasisPattern   = regexp.MustCompile("(\\*\\*|__|\\*|~~|`)")
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// Headings returns the headings of a document, skipping fenced code blocks
+func Headings(content string) []Heading {
+	headings := []Heading{}
+	for _, line := range proseLines(content) {
+		if m := headingPattern.FindStringSubmatch(line); m != nil && m[2] != "" {
+			headings = append(headings, Heading{Level: len(m[1]), Text: inlineText(m[2])})
+		}
+	}
+	return headings
+}
+
+// CountChecklist counts "- [ ]" and "- [x]" items, skipping fenced code blocks
+func CountChecklist(content string) Checklist {
+	var checklist Checklist
+	for _, line := range proseLines(content) {
+		if m := checkboxPattern.FindStringSubmatch(line); m != nil {
+			checklist.Total++
+			if m[1] != " " {
+				checklist.Done++
+			}
+		}
+	}
+	return checklist
+}
+
+// ListItem is a checklist or bullet list item
+type ListItem struct {
+	Text     string
+	Checkbox bool
+	Done     bool
+}
+
+// ListItems returns the checklist and bullet items of a document as plain text,
+// skipping fenced code blocks and empty items
+func ListItems(content string) []ListItem {
+	var items []ListItem
+	for _, line := range proseLines(content) {
+		var item ListItem
+		if m := checkboxPattern.FindStringSubmatch(line); m != nil {
+			item = ListItem{Text: inlineText(m[2]), Checkbox: true, Done: m[1] != " "}
+		} else if listPattern.MatchString(line) {
+			item = ListItem{Text: inlineText(listPattern.ReplaceAllString(line, ""))}
+		} else {
+			continue
+		}
+		if item.Text != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// PlainText strips Markdown syntax, leaving the readable text with single spaces.
+// Code blocks are dropped.
+func PlainText(content string) string {
+	var parts []string
+	for _, line := range proseLines(content) {
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			line = m[2]
+		} else if m := checkboxPattern.FindStringSubmatch(line); m != nil {
+			line = m[2]
+		} else {
+			line = quotePattern.ReplaceAllString(line, "")
+			line = listPattern.ReplaceAllString(line, "")
+		}
+		if text := inlineText(line); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Excerpt returns the start of the document's plain text, cut at a word boundary
+// to at most maxLen characters with an ellipsis when shortened
+func Excerpt(content string, maxLen int) string {
+	text := PlainText(content)
+	if utf8.RuneCountInString(text) <= maxLen {
+		return text
+	}
+
+	runes := []rune(text)
+	cut := string(runes[:maxLen])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// proseLines splits a document into lines, leaving out fenced code blocks
+func proseLines(content string) []string {
+	var lines []string
+	inFence := false
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if fencePattern.MatchString(line) {
+			inFence = !inFence
+			continue
+		}
+		if !inFence {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// inlineText removes inline formatting such as links, emphasis and code spans
+func inlineText(text string) string {
+	text = imagePattern.ReplaceAllString(text, "$1")
+	text = linkPattern.ReplaceAllString(text, "$1")
+	text = emphasisPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+}
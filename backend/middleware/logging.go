@@ -18,6 +18,7 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		
 		// Log the incoming request
 		logger.Info("HTTP request started").
+			Str("request_id", middleware.GetReqID(r.Context())).
 			Str("method", r.Method).
 			Str("path", r.URL.Path).
 			Str("remote_addr", r.RemoteAddr).
@@ -30,6 +31,7 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		// Log the completed request
 		duration := time.Since(start)
 		logger.Info("HTTP request completed").
+			Str("request_id", middleware.GetReqID(r.Context())).
 			Str("method", r.Method).
 			Str("path", r.URL.Path).
 			Int("status_code", ww.Status()).
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type NoteTaskRequest struct {
+	TaskID uint `json:"task_id"`
+}
+
+type ConvertNoteRequest struct {
+	ProjectID   *uint `json:"project_id"`
+	IncludeDone bool  `json:"include_done"`
+}
+
+type ConvertNoteResponse struct {
+	Tasks   []database.Task `json:"tasks"`
+	Skipped int             `json:"skipped"`
+}
+
+// listNoteTasks returns the tasks linked to a note
+func listNoteTasks(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseNoteID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Listing note tasks").Uint("note_id", id).Send()
+
+	var note database.Note
+	if !loadEntity(w, &note, id, "Note") {
+		return
+	}
+
+	var tasks []database.Task
+	result := database.DB.Preload("Project").
+		Where("id IN (?)", database.DB.Model(&database.NoteTask{}).Select("task_id").Where("note_id = ?", id)).
+		Order("id").
+		Find(&tasks)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve note tasks").Uint("note_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully retrieved note tasks").Uint("note_id", id).Int64("count", result.RowsAffected).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// listTaskNotes returns the notes a task is linked to
+func listTaskNotes(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Listing task notes").Uint("task_id", id).Send()
+
+	if !taskExists(w, id) {
+		return
+	}
+
+	var notes []database.Note
+	result := database.DB.
+		Where("id IN (?)", database.DB.Model(&database.NoteTask{}).Select("note_id").Where("task_id = ?", id)).
+		Order("id").
+		Find(&notes)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve task notes").Uint("task_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully retrieved task notes").Uint("task_id", id).Int64("count", result.RowsAffected).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+func linkNoteTask(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseNoteID(r, w)
+	if !ok {
+		return
+	}
+
+	var req NoteTaskRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode note task request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.TaskID == 0 {
+		http.Error(w, "task_id is required", http.StatusBadRequest)
+		return
+	}
+	logger.Info("Linking note to task").Uint("note_id", id).Uint("task_id", req.TaskID).Send()
+
+	var note database.Note
+	if !loadEntity(w, &note, id, "Note") || !taskExists(w, req.TaskID) {
+		return
+	}
+
+	link := database.NoteTask{NoteID: id, TaskID: req.TaskID}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&link)
+	if result.Error != nil {
+		logger.Error("Failed to link note to task").Uint("note_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully linked note to task").Uint("note_id", id).Uint("task_id", req.TaskID).Send()
+	json.NewEncoder(w).Encode(link)
+}
+
+func unlinkNoteTask(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseNoteID(r, w)
+	if !ok {
+		return
+	}
+	taskID, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Unlinking note from task").Uint("note_id", id).Uint("task_id", taskID).Send()
+
+	result := database.DB.Where("note_id = ? AND task_id = ?", id, taskID).Delete(&database.NoteTask{})
+	if result.Error != nil {
+		logger.Error("Failed to unlink note from task").Uint("note_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		logger.Error("Note task link not found").Uint("note_id", id).Uint("task_id", taskID).Send()
+		http.Error(w, "Note task link not found", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("Successfully unlinked note from task").Uint("note_id", id).Uint("task_id", taskID).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+// convertNote turns the note's checklist and bullet items into tasks linked back to
+// the note. Items already linked as a task with the same description are skipped,
+// so converting a note again only picks up new lines.
+func convertNote(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseNoteID(r, w)
+	if !ok {
+		return
+	}
+
+	var req ConvertNoteRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode note conversion request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Info("Converting note to tasks").Uint("note_id", id).Send()
+
+	var note database.Note
+	if !loadEntity(w, &note, id, "Note") {
+		return
+	}
+
+	// Tasks without a project go to the Inbox
+	projectID := database.InboxProjectID
+	if req.ProjectID != nil {
+		projectID = *req.ProjectID
+	}
+	if !projectExists(w, projectID) {
+		return
+	}
+	if archived, err := isProjectArchived(database.DB, projectID); err != nil {
+		logger.Error("Failed to check project").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if archived {
+		logger.Error("Refusing to add tasks to archived project").Uint("project_id", projectID).Send()
+		http.Error(w, "Project is archived", http.StatusConflict)
+		return
+	}
+
+	items := note.ActionItems()
+	if len(items) == 0 {
+		logger.Error("Note has no items to convert").Uint("note_id", id).Send()
+		http.Error(w, "Note has no checklist or list items", http.StatusUnprocessableEntity)
+		return
+	}
+
+	var linked []string
+	err = database.DB.Model(&database.Task{}).
+		Where("id IN (?)", database.DB.Model(&database.NoteTask{}).Select("task_id").Where("note_id = ?", id)).
+		Pluck("description", &linked).Error
+	if err != nil {
+		logger.Error("Failed to retrieve note tasks").Uint("note_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	seen := map[string]bool{}
+	for _, description := range linked {
+		seen[strings.ToLower(description)] = true
+	}
+
+	response := ConvertNoteResponse{Tasks: []database.Task{}}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var maxOrder int
+		if err := tx.Model(&database.Task{}).Select(`COALESCE(MAX("order"), 0)`).Where("project_id = ?", projectID).Scan(&maxOrder).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, item := range items {
+			if (item.Done && !req.IncludeDone) || seen[strings.ToLower(item.Text)] {
+				response.Skipped++
+				continue
+			}
+			seen[strings.ToLower(item.Text)] = true
+
+			maxOrder++
+			task := database.Task{Description: item.Text, ProjectID: &projectID, Order: maxOrder}
+			if item.Done {
+				task.CompletedAt = &now
+			}
+			if err := tx.Create(&task).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&database.NoteTask{NoteID: id, TaskID: task.ID}).Error; err != nil {
+				return err
+			}
+			response.Tasks = append(response.Tasks, task)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to convert note to tasks").Uint("note_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, task := range response.Tasks {
+		recordActivity(r, database.ActivityEntityTask, task.ID, database.ActivityCreate, nil, task)
+	}
+	logger.Info("Successfully converted note to tasks").Uint("note_id", id).Int("created", len(response.Tasks)).Int("skipped", response.Skipped).Send()
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dima-b/go-task-backend/ai"
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+)
+
+// listPlans returns action plans, most recent first, optionally only those with ?status=
+func listPlans(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing action plans").Send()
+
+	query := database.DB.Order("created_at DESC, id DESC")
+	if status := r.URL.Query().Get("status"); status != "" {
+		if !slices.Contains(database.PlanStatuses, status) {
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	var plans []database.ActionPlan
+	result := query.Find(&plans)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve action plans").Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully retrieved action plans").Int64("count", result.RowsAffected).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plans)
+}
+
+func getPlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseIDFromURL(r, w, "planID")
+	if !ok {
+		return
+	}
+	logger.Info("Getting action plan").Uint("plan_id", id).Send()
+
+	var plan database.ActionPlan
+	if !loadEntity(w, &plan, id, "Plan") {
+		return
+	}
+
+	logger.Info("Successfully retrieved action plan").Uint("plan_id", id).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// approvePlan carries out the calls of a pending plan in the order the agent planned
+// them, recording each call's outcome on the plan. A failing call doesn't stop the
+// others. The plan is approved once all its calls are done; otherwise it's failed,
+// and approving it again retries the calls that aren't done.
+func approvePlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseIDFromURL(r, w, "planID")
+	if !ok {
+		return
+	}
+	logger.Info("Approving action plan").Uint("plan_id", id).Send()
+
+	plan, ok := transitionPlan(w, id, database.PlanStatusApproving, database.PlanStatusPending, database.PlanStatusFailed)
+	if !ok {
+		return
+	}
+
+	session := &commandSession{r: r}
+	tools := session.tools()
+	ctx, cancel := commandDeadline(r)
+	defer cancel()
+	var results []string
+	for i, call := range plan.Calls {
+		if call.Done {
+			continue
+		}
+
+		before := len(session.actions)
+		result, err := ai.CallTool(ctx, tools, ai.ToolCall{ID: call.ID, Name: call.Name, Arguments: call.Arguments})
+		if err != nil {
+			// Calls that fail before the tool runs aren't logged by it
+			if len(session.actions) == before {
+				action := AIAction{Tool: call.Name, Error: err.Error()}
+				json.Unmarshal([]byte(call.Arguments), &action.Arguments)
+				session.actions = append(session.actions, action)
+			}
+			plan.Calls[i].Error = err.Error()
+			result = "Error: " + err.Error()
+		} else {
+			plan.Calls[i].Done = true
+			plan.Calls[i].Result = result
+			plan.Calls[i].Error = ""
+		}
+		results = append(results, fmt.Sprintf("- %s %s: %s", call.Name, call.Arguments, result))
+		if err := database.SavePlanCalls(database.DB, &plan); err != nil {
+			logger.Error("Failed to save action plan call").Uint("plan_id", id).Str("call_id", call.ID).Err(err).Send()
+		}
+	}
+
+	if err := database.FinishPlan(database.DB, &plan); err != nil {
+		logger.Error("Failed to save action plan").Uint("plan_id", id).Err(err).Send()
+		// Don't leave the plan approving, so it can be retried or rejected
+		database.DB.Model(&plan).Update("status", database.PlanStatusFailed)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := session.response(ai.Result{})
+	response.ConversationID = plan.ConversationID
+	response.Plan = &plan
+	recordPlanDecision(plan, "I approved the pending changes:\n"+strings.Join(results, "\n"))
+
+	w.Header().Set("Content-Type", "application/json")
+	if plan.Status == database.PlanStatusFailed {
+		logger.Error("Action plan failed").Uint("plan_id", id).Int("actions", len(response.Actions)).Send()
+		response.Error = "some changes failed; approve the plan again to retry them"
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	logger.Info("Successfully approved action plan").Uint("plan_id", id).Int("actions", len(response.Actions)).Send()
+	json.NewEncoder(w).Encode(response)
+}
+
+// rejectPlan drops a pending or failed plan without changing anything more
+func rejectPlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseIDFromURL(r, w, "planID")
+	if !ok {
+		return
+	}
+	logger.Info("Rejecting action plan").Uint("plan_id", id).Send()
+
+	plan, ok := transitionPlan(w, id, database.PlanStatusRejected, database.PlanStatusPending, database.PlanStatusFailed)
+	if !ok {
+		return
+	}
+	recordPlanDecision(plan, "I rejected the pending changes. Don't make them.")
+
+	logger.Info("Successfully rejected action plan").Uint("plan_id", id).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// transitionPlan moves a plan to status, answering 404 for unknown plans and 409 for
+// plans in another state than from. Plans approving for longer than an AI command
+// may run count as failed.
+func transitionPlan(w http.ResponseWriter, id uint, status string, from ...string) (database.ActionPlan, bool) {
+	staleBefore := time.Now().Add(-time.Duration(appEnv.AITimeoutSeconds) * time.Second)
+	plan, err := database.TransitionPlan(database.DB, id, status, staleBefore, from...)
+	switch {
+	case err == nil:
+		return plan, true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		logger.Error("Plan not found").Uint("plan_id", id).Send()
+		http.Error(w, "Plan not found", http.StatusNotFound)
+	case errors.Is(err, database.ErrPlanResolved):
+		logger.Error("Plan can't change state").Uint("plan_id", id).Str("status", plan.Status).Send()
+		http.Error(w, "Plan is "+plan.Status, http.StatusConflict)
+	default:
+		logger.Error("Failed to update plan").Uint("plan_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return plan, false
+}
+
+// recordPlanDecision tells the plan's conversation, if any, what the user decided, so
+// the agent knows on the next message
+func recordPlanDecision(plan database.ActionPlan, message string) {
+	if plan.ConversationID == nil {
+		return
+	}
+	var conversation database.Conversation
+	err := database.DB.Where("id = ?", *plan.ConversationID).First(&conversation).Error
+	if err == nil {
+		err = database.AppendConversation(database.DB, &conversation, []database.ConversationMessage{{Role: ai.RoleUser, Content: message}}, 0)
+	}
+	if err != nil {
+		logger.Error("Failed to record plan decision").Uint("plan_id", plan.ID).Uint("conversation_id", *plan.ConversationID).Err(err).Send()
+	}
+}
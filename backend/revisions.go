@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+)
+
+// RevisionDiff compares two versions of a note. A nil revision ID is the note as it
+// is now.
+type RevisionDiff struct {
+	FromRevisionID *uint            `json:"from_revision_id"`
+	ToRevisionID   *uint            `json:"to_revision_id"`
+	FromTitle      string           `json:"from_title"`
+	ToTitle        string           `json:"to_title"`
+	Lines          []utils.DiffLine `json:"lines"`
+}
+
+// listNoteRevisions returns the earlier versions of a note, most recent first
+func listNoteRevisions(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseNoteID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Listing note revisions").Uint("note_id", id).Send()
+
+	var note database.Note
+	if !loadEntity(w, &note, id, "Note") {
+		return
+	}
+
+	var revisions []database.NoteRevision
+	result := database.DB.Where("note_id = ?", id).Order("created_at DESC, id DESC").Find(&revisions)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve note revisions").Uint("note_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully retrieved note revisions").Uint("note_id", id).Int64("count", result.RowsAffected).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// diffNoteRevision diffs a revision against the current note, or against another
+// revision given as ?against=
+func diffNoteRevision(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseNoteID(r, w)
+	if !ok {
+		return
+	}
+	revisionID, ok := utils.ParseIDFromURL(r, w, "revisionID")
+	if !ok {
+		return
+	}
+	logger.Info("Diffing note revision").Uint("note_id", id).Uint("revision_id", revisionID).Send()
+
+	var note database.Note
+	if !loadEntity(w, &note, id, "Note") {
+		return
+	}
+	from, ok := loadRevision(w, id, revisionID)
+	if !ok {
+		return
+	}
+
+	diff := RevisionDiff{FromRevisionID: &from.ID, FromTitle: from.Title, ToTitle: note.Title}
+	toContent := note.Content
+	if againstParam := r.URL.Query().Get("against"); againstParam != "" {
+		againstID, err := strconv.ParseUint(againstParam, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid against", http.StatusBadRequest)
+			return
+		}
+		to, ok := loadRevision(w, id, uint(againstID))
+		if !ok {
+			return
+		}
+		diff.ToRevisionID = &to.ID
+		diff.ToTitle = to.Title
+		toContent = to.Content
+	}
+	lines, err := utils.DiffLines(from.Content, toContent)
+	if err != nil {
+		logger.Error("Note revision diff is too large").Uint("note_id", id).Uint("revision_id", revisionID).Send()
+		http.Error(w, "Diff is too large", http.StatusUnprocessableEntity)
+		return
+	}
+	diff.Lines = lines
+
+	logger.Info("Successfully diffed note revision").Uint("note_id", id).Uint("revision_id", revisionID).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+func restoreNoteRevision(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseNoteID(r, w)
+	if !ok {
+		return
+	}
+	revisionID, ok := utils.ParseIDFromURL(r, w, "revisionID")
+	if !ok {
+		return
+	}
+	logger.Info("Restoring note revision").Uint("note_id", id).Uint("revision_id", revisionID).Send()
+
+	var before database.Note
+	if !loadEntity(w, &before, id, "Note") {
+		return
+	}
+
+	note, err := database.RestoreRevision(database.DB, id, revisionID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logger.Error("Note revision not found").Uint("note_id", id).Uint("revision_id", revisionID).Send()
+			http.Error(w, "Note revision not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to restore note revision").Uint("note_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recordActivity(r, database.ActivityEntityNote, id, database.ActivityUpdate, before, note)
+
+	logger.Info("Successfully restored note revision").Uint("note_id", id).Uint("revision_id", revisionID).Send()
+	json.NewEncoder(w).Encode(note)
+}
+
+// loadRevision fetches a revision of the given note, writing a 404 when it doesn't exist
+func loadRevision(w http.ResponseWriter, noteID, revisionID uint) (database.NoteRevision, bool) {
+	var revision database.NoteRevision
+	err := database.DB.Where("id = ? AND note_id = ?", revisionID, noteID).First(&revision).Error
+	if err == nil {
+		return revision, true
+	}
+	if err == gorm.ErrRecordNotFound {
+		logger.Error("Note revision not found").Uint("note_id", noteID).Uint("revision_id", revisionID).Send()
+		http.Error(w, "Note revision not found", http.StatusNotFound)
+		return revision, false
+	}
+	logger.Error("Failed to fetch note revision").Uint("revision_id", revisionID).Err(err).Send()
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+	return revision, false
+}
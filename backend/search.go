@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+)
+
+// Search pages hold 20 results unless asked otherwise, and at most 100
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+func search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	logger.Info("Searching").Str("query", query).Send()
+
+	if query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	var types []string
+	if typeParam := r.URL.Query().Get("type"); typeParam != "" {
+		for _, t := range strings.Split(typeParam, ",") {
+			t = strings.TrimSpace(t)
+			if !slices.Contains(database.SearchTypes, t) {
+				http.Error(w, "type must be one or more of: "+strings.Join(database.SearchTypes, ", "), http.StatusBadRequest)
+				return
+			}
+			types = append(types, t)
+		}
+	}
+
+	limit, err := utils.QueryInt(r, "limit", defaultSearchLimit)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	offset, err := utils.QueryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	results, err := database.Search(database.DB, database.SearchQuery{
+		Query:           query,
+		Types:           types,
+		IncludeArchived: utils.QueryBool(r, "include_archived"),
+		Limit:           min(limit, maxSearchLimit),
+		Offset:          offset,
+	})
+	if err != nil {
+		logger.Error("Failed to search").Str("query", query).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully searched").Str("query", query).Int("count", len(results)).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
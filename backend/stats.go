@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+)
+
+// defaultStatsPeriod is how many days statistics cover when no range is given
+const defaultStatsPeriod = 30
+
+type StatsResponse struct {
+	From             string                       `json:"from"`
+	To               string                       `json:"to"`
+	TimeZone         string                       `json:"tz"`
+	CompletedPerDay  []database.DateCount         `json:"completed_per_day"`
+	CompletedPerWeek []database.DateCount         `json:"completed_per_week"`
+	OverdueTrend     []database.DateCount         `json:"overdue_trend"`
+	TimeToComplete   database.CompletionTimeStats `json:"time_to_complete"`
+	Projects         []database.ProjectBreakdown  `json:"projects"`
+	Labels           []database.LabelBreakdown    `json:"labels"`
+}
+
+type WeeklyDigest struct {
+	From           string                       `json:"from"`
+	To             string                       `json:"to"`
+	TimeZone       string                       `json:"tz"`
+	Completed      int64                        `json:"completed"`
+	PreviousWeek   int64                        `json:"previous_week"`
+	BusiestDay     *database.DateCount          `json:"busiest_day"`
+	Overdue        int64                        `json:"overdue"`
+	TimeToComplete database.CompletionTimeStats `json:"time_to_complete"`
+	TopProjects    []database.ProjectBreakdown  `json:"top_projects"`
+	TopLabels      []database.LabelBreakdown    `json:"top_labels"`
+	Text           string                       `json:"text"`
+}
+
+func getStats(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Computing statistics").Send()
+
+	loc, from, to, ok := parseStatsRange(w, r, defaultStatsPeriod)
+	if !ok {
+		return
+	}
+	sr := database.StatsRange{From: from, To: to.AddDate(0, 0, 1), TimeZone: loc.String()}
+
+	response := StatsResponse{
+		From:     from.Format(utils.DateLayout),
+		To:       to.Format(utils.DateLayout),
+		TimeZone: loc.String(),
+	}
+
+	perDay, err := database.CompletedPer("day", sr)
+	if err == nil {
+		response.CompletedPerDay = fillDates(perDay, from, to, 1)
+		var perWeek []database.DateCount
+		perWeek, err = database.CompletedPer("week", sr)
+		response.CompletedPerWeek = fillDates(perWeek, startOfWeek(from), to, 7)
+	}
+	if err == nil {
+		response.OverdueTrend, err = database.OverdueTrend(sr)
+	}
+	if err == nil {
+		response.TimeToComplete, err = database.TimeToComplete(sr)
+	}
+	if err == nil {
+		response.Projects, err = database.ProjectBreakdowns(sr)
+	}
+	if err == nil {
+		response.Labels, err = database.LabelBreakdowns(sr)
+	}
+	if err != nil {
+		logger.Error("Failed to compute statistics").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully computed statistics").Str("from", response.From).Str("to", response.To).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func getWeeklyDigest(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Generating weekly digest").Send()
+
+	loc, err := utils.QueryLocation(r)
+	if err != nil {
+		logger.Error("Invalid time zone").Str("tz", r.URL.Query().Get("tz")).Err(err).Send()
+		http.Error(w, "Invalid tz", http.StatusBadRequest)
+		return
+	}
+
+	// Default to the last full week
+	now := time.Now().In(loc)
+	week, err := utils.ParseDateParam(r.URL.Query().Get("week"), loc, startOfWeek(now).AddDate(0, 0, -7))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	digest, err := buildWeeklyDigest(startOfWeek(week), loc)
+	if err != nil {
+		logger.Error("Failed to generate weekly digest").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully generated weekly digest").Str("from", digest.From).Int64("completed", digest.Completed).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(digest)
+}
+
+// buildWeeklyDigest summarizes the week starting on the given Monday
+func buildWeeklyDigest(monday time.Time, loc *time.Location) (WeeklyDigest, error) {
+	sunday := monday.AddDate(0, 0, 6)
+	sr := database.StatsRange{From: monday, To: monday.AddDate(0, 0, 7), TimeZone: loc.String()}
+	previous := database.StatsRange{From: monday.AddDate(0, 0, -7), To: monday, TimeZone: loc.String()}
+
+	digest := WeeklyDigest{
+		From:     monday.Format(utils.DateLayout),
+		To:       sunday.Format(utils.DateLayout),
+		TimeZone: loc.String(),
+	}
+
+	perDay, err := database.CompletedPer("day", sr)
+	if err != nil {
+		return digest, err
+	}
+	for i, day := range perDay {
+		digest.Completed += day.Count
+		if digest.BusiestDay == nil || day.Count > digest.BusiestDay.Count {
+			digest.BusiestDay = &perDay[i]
+		}
+	}
+
+	previousDays, err := database.CompletedPer("day", previous)
+	if err != nil {
+		return digest, err
+	}
+	for _, day := range previousDays {
+		digest.PreviousWeek += day.Count
+	}
+
+	overdue, err := database.OverdueTrend(sr)
+	if err != nil {
+		return digest, err
+	}
+	if len(overdue) > 0 {
+		digest.Overdue = overdue[len(overdue)-1].Count
+	}
+
+	if digest.TimeToComplete, err = database.TimeToComplete(sr); err != nil {
+		return digest, err
+	}
+
+	projects, err := database.ProjectBreakdowns(sr)
+	if err != nil {
+		return digest, err
+	}
+	sort.SliceStable(projects, func(i, j int) bool { return projects[i].Completed > projects[j].Completed })
+	for _, p := range projects {
+		if p.Completed == 0 || len(digest.TopProjects) == 3 {
+			break
+		}
+		digest.TopProjects = append(digest.TopProjects, p)
+	}
+
+	labels, err := database.LabelBreakdowns(sr)
+	if err != nil {
+		return digest, err
+	}
+	for _, l := range labels {
+		if l.Completed == 0 || len(digest.TopLabels) == 3 {
+			break
+		}
+		digest.TopLabels = append(digest.TopLabels, l)
+	}
+
+	digest.Text = digest.render()
+	return digest, nil
+}
+
+// render formats the digest as Markdown for notes or messages
+func (d WeeklyDigest) render() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Week of %s\n\n", d.From)
+	fmt.Fprintf(&b, "- Completed %d tasks", d.Completed)
+	switch {
+	case d.Completed > d.PreviousWeek:
+		fmt.Fprintf(&b, " (up from %d)", d.PreviousWeek)
+	case d.Completed < d.PreviousWeek:
+		fmt.Fprintf(&b, " (down from %d)", d.PreviousWeek)
+	}
+	b.WriteString("\n")
+	if d.BusiestDay != nil {
+		fmt.Fprintf(&b, "- Busiest day: %s with %d\n", d.BusiestDay.Date, d.BusiestDay.Count)
+	}
+	fmt.Fprintf(&b, "- Overdue at the end of the week: %d\n", d.Overdue)
+	if d.TimeToComplete.MedianHours != nil {
+		fmt.Fprintf(&b, "- Median time to complete: %.1f hours\n", *d.TimeToComplete.MedianHours)
+	}
+	if len(d.TopProjects) > 0 {
+		b.WriteString("\n## Top projects\n\n")
+		for _, p := range d.TopProjects {
+			fmt.Fprintf(&b, "- %s: %d completed, %d open\n", p.Name, p.Completed, p.Open)
+		}
+	}
+	if len(d.TopLabels) > 0 {
+		b.WriteString("\n## Top labels\n\n")
+		for _, l := range d.TopLabels {
+			fmt.Fprintf(&b, "- %s: %d completed\n", l.Label, l.Completed)
+		}
+	}
+	return b.String()
+}
+
+// parseStatsRange reads the tz, from and to query parameters. from and to are inclusive
+// calendar days; the range defaults to the last period days.
+func parseStatsRange(w http.ResponseWriter, r *http.Request, period int) (*time.Location, time.Time, time.Time, bool) {
+	loc, err := utils.QueryLocation(r)
+	if err != nil {
+		logger.Error("Invalid time zone").Str("tz", r.URL.Query().Get("tz")).Err(err).Send()
+		http.Error(w, "Invalid tz", http.StatusBadRequest)
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	to, err := utils.ParseDateParam(r.URL.Query().Get("to"), loc, today)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, time.Time{}, time.Time{}, false
+	}
+	from, err := utils.ParseDateParam(r.URL.Query().Get("from"), loc, to.AddDate(0, 0, 1-period))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, time.Time{}, time.Time{}, false
+	}
+	if from.After(to) {
+		http.Error(w, "from must not be after to", http.StatusBadRequest)
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	return loc, from, to, true
+}
+
+// fillDates returns a continuous series from..to stepping by the given number of days,
+// taking counts from the query results and zero elsewhere
+func fillDates(counts []database.DateCount, from, to time.Time, step int) []database.DateCount {
+	byDate := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		byDate[c.Date] = c.Count
+	}
+
+	var series []database.DateCount
+	for day := from; !day.After(to); day = day.AddDate(0, 0, step) {
+		key := day.Format(utils.DateLayout)
+		series = append(series, database.DateCount{Date: key, Count: byDate[key]})
+	}
+	return series
+}
+
+// startOfWeek returns the Monday of the week containing t, matching Postgres date_trunc
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	day := t.AddDate(0, 0, -offset)
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, t.Location())
+}
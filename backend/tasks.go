@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errProjectArchived refuses changes to the tasks of an archived project
+var errProjectArchived = errors.New("Project is archived")
+
+// errProjectNotFound refuses tasks for a project that doesn't exist or is in the trash
+var errProjectNotFound = errors.New("Project not found")
+
+// invalidTaskError is a task from a client that can't be saved as sent
+type invalidTaskError struct{ error }
+
+// saveNewTask validates a new task, fills in its project and order and creates it
+// with db. Refused tasks return an invalidTaskError, errProjectNotFound or
+// errProjectArchived.
+func saveNewTask(db *gorm.DB, t *database.Task) error {
+	if err := utils.ValidateTaskRecurrence(t.Recurrence, t.DueDate, t.DueDatetime); err != nil {
+		return invalidTaskError{err}
+	}
+	if err := utils.ValidateHabit(t.IsHabit, t.Recurrence); err != nil {
+		return invalidTaskError{err}
+	}
+
+	// Tasks are only trashed through DELETE
+	t.DeletedAt = gorm.DeletedAt{}
+
+	// Tasks without a project go to the Inbox
+	if t.ProjectID == nil {
+		inboxID := database.InboxProjectID
+		t.ProjectID = &inboxID
+	}
+
+	// Trashed projects are left out, so their tasks can't be added to
+	var project database.Project
+	err := db.Select("id", "archived_at").Where("id = ?", *t.ProjectID).First(&project).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errProjectNotFound
+	} else if err != nil {
+		return err
+	} else if project.ArchivedAt != nil {
+		return errProjectArchived
+	}
+
+	// Set order if not provided
+	if t.Order == 0 {
+		var maxOrder int
+		db.Model(&database.Task{}).Select("COALESCE(MAX(order), 0)").Where("project_id = ?", t.ProjectID).Scan(&maxOrder)
+		t.Order = maxOrder + 1
+	}
+
+	return db.Create(t).Error
+}
+
+// markTaskComplete completes a task with db, or moves a recurring task on to its next
+// occurrence, and returns the tasks that were waiting on it
+func markTaskComplete(db *gorm.DB, task database.Task) ([]uint, error) {
+	// Tasks of archived projects are frozen
+	if task.ProjectID != nil {
+		if archived, err := isProjectArchived(db, *task.ProjectID); err != nil {
+			return nil, err
+		} else if archived {
+			return nil, errProjectArchived
+		}
+	}
+
+	now := time.Now()
+	updates := map[string]any{
+		"completed_at": &now,
+	}
+
+	// Handle recurring tasks
+	if task.Recurrence != "" {
+		// Calculate next due date/datetime
+		nextDue, err := utils.CalculateNextDueDate(task.Recurrence, task.CurrentDue())
+		if err != nil {
+			return nil, fmt.Errorf("Failed to calculate next due date: %w", err)
+		}
+
+		if nextDue != nil {
+			// Update the appropriate due field
+			if task.DueDatetime != nil {
+				updates["due_datetime"] = nextDue
+			} else if task.DueDate != nil {
+				// For date-only, set to date part only
+				dateOnly := time.Date(nextDue.Year(), nextDue.Month(), nextDue.Day(), 0, 0, 0, 0, nextDue.Location())
+				updates["due_date"] = &dateOnly
+			}
+		}
+
+		// For recurring tasks, clear completed_at to keep them active
+		updates["completed_at"] = nil
+		logger.Info("Recurring task - updated due date and cleared completion").Uint("task_id", task.ID).Send()
+	}
+
+	// Remember which occurrence was completed for habit and productivity statistics.
+	// Habits are checked in for the day they're done on.
+	occurredOn := now
+	if currentDue := task.CurrentDue(); currentDue != nil && task.Recurrence != "" && !task.IsHabit {
+		occurredOn = *currentDue
+	}
+	completion := database.TaskCompletion{
+		TaskID:      task.ID,
+		OccurredOn:  time.Date(occurredOn.Year(), occurredOn.Month(), occurredOn.Day(), 0, 0, 0, 0, time.UTC),
+		CompletedAt: now,
+	}
+
+	var unblocked []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.Task{}).Where("id = ?", task.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&completion).Error; err != nil {
+			return err
+		}
+		// Tasks waiting on this one can start now. A recurring task isn't done, it
+		// only moves on to its next occurrence, so its dependents keep waiting.
+		if task.Recurrence != "" {
+			return nil
+		}
+		var err error
+		unblocked, err = database.UnblockDependents(tx, task.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Linked goals' progress changed
+	if err := database.TouchGoalsForTask(db, task); err != nil {
+		logger.Warn("Failed to touch goals for task").Uint("task_id", task.ID).Err(err).Send()
+	}
+	return unblocked, nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+)
+
+// errTimerRunning is returned when a timer is started while another one runs
+var errTimerRunning = errors.New("a timer is already running")
+
+type TimeEntryRequest struct {
+	StartedAt *time.Time `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Minutes   float64    `json:"minutes"`
+	Note      string     `json:"note"`
+}
+
+type TaskTimeResponse struct {
+	TaskID            uint                 `json:"task_id"`
+	EstimatedMinutes  *int                 `json:"estimated_minutes"`
+	ActualMinutes     float64              `json:"actual_minutes"`
+	DifferenceMinutes *float64             `json:"difference_minutes"`
+	Running           *database.TimeEntry  `json:"running"`
+	Entries           []database.TimeEntry `json:"entries"`
+}
+
+func getRunningTimer(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Getting running timer").Send()
+
+	var entry database.TimeEntry
+	result := database.DB.Where("ended_at IS NULL").Limit(1).Find(&entry)
+	if result.Error != nil {
+		logger.Error("Failed to retrieve running timer").Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.RowsAffected == 0 {
+		json.NewEncoder(w).Encode(nil)
+		return
+	}
+	json.NewEncoder(w).Encode(entry)
+}
+
+func startTimer(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Starting timer").Uint("task_id", id).Send()
+
+	if !taskExists(w, id) {
+		return
+	}
+
+	entry := database.TimeEntry{
+		TaskID:    id,
+		StartedAt: time.Now(),
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var running int64
+		if err := tx.Model(&database.TimeEntry{}).Where("ended_at IS NULL").Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return errTimerRunning
+		}
+		return tx.Create(&entry).Error
+	})
+	if err != nil {
+		if errors.Is(err, errTimerRunning) {
+			logger.Error("Timer already running").Uint("task_id", id).Send()
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		logger.Error("Failed to start timer").Uint("task_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully started timer").Uint("task_id", id).Uint("entry_id", entry.ID).Send()
+	json.NewEncoder(w).Encode(entry)
+}
+
+func stopTimer(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Stopping timer").Uint("task_id", id).Send()
+
+	var entry database.TimeEntry
+	result := database.DB.Where("task_id = ? AND ended_at IS NULL", id).First(&entry)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			logger.Error("No running timer for task").Uint("task_id", id).Send()
+			http.Error(w, "No running timer for this task", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to fetch running timer").Uint("task_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	entry.EndedAt = &now
+	result = database.DB.Model(&entry).Update("ended_at", &now)
+	if result.Error != nil {
+		logger.Error("Failed to stop timer").Uint("entry_id", entry.ID).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully stopped timer").Uint("task_id", id).Uint("entry_id", entry.ID).Dur("duration", now.Sub(entry.StartedAt)).Send()
+	json.NewEncoder(w).Encode(entry)
+}
+
+func createTimeEntry(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Logging time entry").Uint("task_id", id).Send()
+
+	var req TimeEntryRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("Failed to decode time entry request").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Either an explicit span, or a number of minutes ending now or at ended_at
+	endedAt := time.Now()
+	if req.EndedAt != nil {
+		endedAt = *req.EndedAt
+	}
+	var startedAt time.Time
+	switch {
+	case req.StartedAt != nil:
+		startedAt = *req.StartedAt
+	case req.Minutes > 0:
+		startedAt = endedAt.Add(-time.Duration(req.Minutes * float64(time.Minute)))
+	default:
+		http.Error(w, "started_at or minutes is required", http.StatusBadRequest)
+		return
+	}
+	if !endedAt.After(startedAt) {
+		http.Error(w, "ended_at must be after started_at", http.StatusBadRequest)
+		return
+	}
+
+	if !taskExists(w, id) {
+		return
+	}
+
+	entry := database.TimeEntry{
+		TaskID:    id,
+		StartedAt: startedAt,
+		EndedAt:   &endedAt,
+		Note:      req.Note,
+		Manual:    true,
+	}
+	result := database.DB.Create(&entry)
+	if result.Error != nil {
+		logger.Error("Failed to log time entry").Uint("task_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully logged time entry").Uint("task_id", id).Uint("entry_id", entry.ID).Send()
+	json.NewEncoder(w).Encode(entry)
+}
+
+func deleteTimeEntry(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Deleting time entry").Send()
+
+	id, ok := utils.ParseIDFromURL(r, w, "entryID")
+	if !ok {
+		return
+	}
+
+	result := database.DB.Delete(&database.TimeEntry{}, id)
+	if result.Error != nil {
+		logger.Error("Failed to delete time entry").Uint("entry_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully deleted time entry").Uint("entry_id", id).Send()
+	w.WriteHeader(http.StatusOK)
+}
+
+func getTaskTime(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Getting task time").Uint("task_id", id).Send()
+
+	var task database.Task
+	result := database.DB.Preload("TimeEntries", func(db *gorm.DB) *gorm.DB { return db.Order("started_at") }).
+		Where("id = ?", id).First(&task)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			logger.Error("Task not found").Uint("task_id", id).Send()
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to fetch task").Uint("task_id", id).Err(result.Error).Send()
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	response := TaskTimeResponse{
+		TaskID:           task.ID,
+		EstimatedMinutes: task.EstimatedMinutes,
+		Entries:          task.TimeEntries,
+	}
+	for i, entry := range task.TimeEntries {
+		response.ActualMinutes += entry.Duration(now).Minutes()
+		if entry.EndedAt == nil {
+			response.Running = &task.TimeEntries[i]
+		}
+	}
+	if task.EstimatedMinutes != nil {
+		difference := response.ActualMinutes - float64(*task.EstimatedMinutes)
+		response.DifferenceMinutes = &difference
+	}
+
+	logger.Info("Successfully retrieved task time").Uint("task_id", id).Float64("actual_minutes", response.ActualMinutes).Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// taskExists writes a 404 response and returns false if the task doesn't exist
+func taskExists(w http.ResponseWriter, id uint) bool {
+	var count int64
+	if err := database.DB.Model(&database.Task{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		logger.Error("Failed to fetch task").Uint("task_id", id).Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if count == 0 {
+		logger.Error("Task not found").Uint("task_id", id).Send()
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
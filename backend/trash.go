@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+	"gorm.io/gorm"
+)
+
+// trashPurgeInterval is how often expired items are removed from the trash
+const trashPurgeInterval = time.Hour
+
+type TrashResponse struct {
+	database.Trash
+	RetentionDays int `json:"retention_days"`
+}
+
+func listTrash(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing trash").Send()
+
+	trash, err := database.ListTrash(database.DB)
+	if err != nil {
+		logger.Error("Failed to retrieve trash").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully retrieved trash").
+		Int("tasks", len(trash.Tasks)).
+		Int("projects", len(trash.Projects)).
+		Int("notes", len(trash.Notes)).
+		Send()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TrashResponse{Trash: trash, RetentionDays: appEnv.TrashRetentionDays})
+}
+
+func emptyTrash(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Emptying trash").Send()
+
+	purged, err := database.PurgeTrash(database.DB, time.Now())
+	if err != nil {
+		logger.Error("Failed to empty trash").Err(err).Send()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully emptied trash").Int64("tasks", purged.Tasks).Int64("projects", purged.Projects).Int64("notes", purged.Notes).Send()
+	json.NewEncoder(w).Encode(purged)
+}
+
+func restoreTask(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseTaskID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Restoring task").Uint("task_id", id).Send()
+
+	task, err := database.RestoreTask(database.DB, id)
+	if err != nil {
+		writeRestoreError(w, "Task", id, err)
+		return
+	}
+
+	recordActivity(r, database.ActivityEntityTask, id, database.ActivityRestore, nil, task)
+	logger.Info("Successfully restored task").Uint("task_id", id).Send()
+	json.NewEncoder(w).Encode(task)
+}
+
+func restoreProject(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseProjectID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Restoring project").Uint("project_id", id).Send()
+
+	project, err := database.RestoreProject(database.DB, id)
+	if err != nil {
+		writeRestoreError(w, "Project", id, err)
+		return
+	}
+
+	recordActivity(r, database.ActivityEntityProject, id, database.ActivityRestore, nil, project)
+	logger.Info("Successfully restored project").Uint("project_id", id).Send()
+	json.NewEncoder(w).Encode(project)
+}
+
+func restoreNote(w http.ResponseWriter, r *http.Request) {
+	id, ok := utils.ParseNoteID(r, w)
+	if !ok {
+		return
+	}
+	logger.Info("Restoring note").Uint("note_id", id).Send()
+
+	note, err := database.RestoreNote(database.DB, id)
+	if err != nil {
+		writeRestoreError(w, "Note", id, err)
+		return
+	}
+
+	recordActivity(r, database.ActivityEntityNote, id, database.ActivityRestore, nil, note)
+	logger.Info("Successfully restored note").Uint("note_id", id).Send()
+	json.NewEncoder(w).Encode(note)
+}
+
+func writeRestoreError(w http.ResponseWriter, name string, id uint, err error) {
+	if err == gorm.ErrRecordNotFound {
+		logger.Error(name+" not in trash").Uint("id", id).Send()
+		http.Error(w, name+" not found in trash", http.StatusNotFound)
+		return
+	}
+	logger.Error("Failed to restore "+name).Uint("id", id).Err(err).Send()
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// runTrashPurge permanently deletes items that have been in the trash longer than
+// retention, once at startup and then periodically
+func runTrashPurge(retention time.Duration) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := database.PurgeTrash(database.DB, time.Now().Add(-retention))
+		if err != nil {
+			logger.Error("Failed to purge trash").Err(err).Send()
+		} else if purged.Tasks+purged.Projects+purged.Notes > 0 {
+			logger.Info("Purged expired trash").Int64("tasks", purged.Tasks).Int64("projects", purged.Projects).Int64("notes", purged.Notes).Send()
+		}
+		<-ticker.C
+	}
+}
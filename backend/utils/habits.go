@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateLayout is the format used for calendar days in API requests and responses
+const DateLayout = "2006-01-02"
+
+// HabitDay is a single calendar day of a habit heatmap
+type HabitDay struct {
+	Date      string `json:"date"`
+	Scheduled bool   `json:"scheduled"`
+	Done      bool   `json:"done"`
+}
+
+// HabitStats summarizes how consistently a habit was kept
+type HabitStats struct {
+	CurrentStreak  int        `json:"current_streak"`
+	BestStreak     int        `json:"best_streak"`
+	ScheduledDays  int        `json:"scheduled_days"`
+	CompletedDays  int        `json:"completed_days"`
+	CompletionRate float64    `json:"completion_rate"`
+	Heatmap        []HabitDay `json:"heatmap,omitempty"`
+}
+
+// HabitOptions describes the habit and the period to report on.
+// All times are interpreted in Location; days are compared by calendar date.
+type HabitOptions struct {
+	Recurrence string
+	Anchor     time.Time
+	Start      time.Time
+	From       time.Time
+	To         time.Time
+	Today      time.Time
+	CheckIns   []time.Time
+	Location   *time.Location
+	Heatmap    bool
+}
+
+// ValidateHabit checks that only recurring tasks are marked as habits
+func ValidateHabit(isHabit bool, recurrence string) error {
+	if isHabit && recurrence == "" {
+		return fmt.Errorf("habit must be a recurring task")
+	}
+	return nil
+}
+
+// ComputeHabitStats derives streaks, completion rate and a heatmap from check-in dates.
+//
+// Only days the recurrence schedules count towards streaks and the completion rate, so a
+// Mon/Wed/Fri habit isn't broken by a quiet Tuesday. Streaks are computed over the whole
+// history from Start; the rate and heatmap cover From..To. Today never breaks a streak
+// since it can still be checked in.
+func ComputeHabitStats(opts HabitOptions) (HabitStats, error) {
+	var stats HabitStats
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	done := make(map[string]bool, len(opts.CheckIns))
+	for _, c := range opts.CheckIns {
+		done[c.In(loc).Format(DateLayout)] = true
+	}
+
+	start := startOfDay(opts.Start, loc)
+	today := startOfDay(opts.Today, loc)
+	from := startOfDay(opts.From, loc)
+	to := startOfDay(opts.To, loc)
+	if to.After(today) {
+		to = today
+	}
+	anchor := opts.Anchor.In(loc)
+
+	// Check-ins made before the task was created still count
+	for _, c := range opts.CheckIns {
+		if day := startOfDay(c, loc); day.Before(start) {
+			start = day
+		}
+	}
+
+	run := 0
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		scheduled, err := IsScheduledOn(opts.Recurrence, anchor, day)
+		if err != nil {
+			return stats, err
+		}
+		key := day.Format(DateLayout)
+		isDone := done[key]
+		isToday := day.Equal(today)
+
+		if scheduled {
+			if isDone {
+				run++
+				stats.BestStreak = max(stats.BestStreak, run)
+			} else if !isToday {
+				run = 0
+			}
+		}
+
+		if day.Before(from) || day.After(to) {
+			continue
+		}
+		if scheduled && (isDone || !isToday) {
+			stats.ScheduledDays++
+			if isDone {
+				stats.CompletedDays++
+			}
+		}
+		if opts.Heatmap {
+			stats.Heatmap = append(stats.Heatmap, HabitDay{Date: key, Scheduled: scheduled, Done: isDone})
+		}
+	}
+
+	stats.CurrentStreak = run
+	if stats.ScheduledDays > 0 {
+		stats.CompletionRate = float64(stats.CompletedDays) / float64(stats.ScheduledDays)
+	}
+
+	return stats, nil
+}
+
+// ParseDateParam parses a YYYY-MM-DD date in the given location, returning fallback if empty
+func ParseDateParam(value string, loc *time.Location, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	t, err := time.ParseInLocation(DateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	return t, nil
+}
+
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
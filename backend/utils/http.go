@@ -3,6 +3,7 @@ package utils
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/dima-b/go-task-backend/logger"
 	"github.com/go-chi/chi/v5"
@@ -20,6 +21,30 @@ func ParseIDFromURL(r *http.Request, w http.ResponseWriter, paramName string) (u
 	return uint(id), true
 }
 
+// QueryBool reports whether a query parameter is set to a true value
+func QueryBool(r *http.Request, name string) bool {
+	value, err := strconv.ParseBool(r.URL.Query().Get(name))
+	return err == nil && value
+}
+
+// QueryInt parses an integer query parameter, returning fallback when it is absent
+func QueryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// QueryLocation loads the IANA time zone named by the "tz" query parameter, defaulting to the server's
+func QueryLocation(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
 // ParseTaskID is a convenience function for parsing task IDs
 func ParseTaskID(r *http.Request, w http.ResponseWriter) (uint, bool) {
 	return ParseIDFromURL(r, w, "taskID")
@@ -33,4 +58,9 @@ func ParseProjectID(r *http.Request, w http.ResponseWriter) (uint, bool) {
 // ParseNoteID is a convenience function for parsing note IDs
 func ParseNoteID(r *http.Request, w http.ResponseWriter) (uint, bool) {
 	return ParseIDFromURL(r, w, "noteID")
-}
\ No newline at end of file
+}
+
+// ParseGoalID is a convenience function for parsing goal IDs
+func ParseGoalID(r *http.Request, w http.ResponseWriter) (uint, bool) {
+	return ParseIDFromURL(r, w, "goalID")
+}
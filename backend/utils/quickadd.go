@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// QuickTask is a task read from a line of free text
+type QuickTask struct {
+	Description string
+	DueDate     *time.Time
+	Recurrence  string
+	Project     string
+	Labels      []string
+}
+
+var numberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+const weekdayNames = `(?:sun|mon|tue|tues|wed|thu|thur|thurs|fri|sat)(?:day|nesday|rsday|urday)?s?`
+
+// fullWeekdayNames leaves out abbreviations, which are often just words ("Mon Repos")
+const fullWeekdayNames = `(?:sun|mon|tues|wednes|thurs|fri|satur)days?`
+
+var (
+	quickSplitPattern      = regexp.MustCompile(`(?i)[\n;]+|[.!?]+(?:\s+|$)|,?\s+and then\s+|,\s*then\s+`)
+	quickFillerPattern     = regexp.MustCompile(`(?i)^(?:(?:please|ok(?:ay)?|so|also|and|then)\s+)*(?:(?:remind me to|remember to|don't forget to|do not forget to|i need to|i have to|i should|i must|i want to|we need to|need to|have to|add a task to|add task|add|todo|to do)\s+)?`)
+	quickLabelPattern      = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_-]+)`)
+	quickProjectPattern    = regexp.MustCompile(`(?i)\s+(?:in|to|for|under) (?:the |my )?(?:project ([\p{L}\p{N}_ -]+?)|([\p{L}\p{N}_-]+(?: [\p{L}\p{N}_-]+)?) project)\s*$`)
+	quickEveryPattern      = regexp.MustCompile(`(?i)\b(?:every|each) (day|weekday|week|month on the \d{1,2}(?:st|nd|rd|th)?|\d{1,2}(?:st|nd|rd|th) of the month|` + weekdayNames + `(?:(?:,| and|, and) ` + weekdayNames + `)*)\b|\b(daily|weekly)\b`)
+	quickTodayPattern      = regexp.MustCompile(`(?i)\b(?:by |for )?(today|tonight|this evening|day after tomorrow|tomorrow)\b`)
+	quickInPattern         = regexp.MustCompile(`(?i)\bin (\d+|a|an|one|two|three|four|five|six|seven|eight|nine|ten) (day|week|month)s?\b`)
+	quickWeekdayPattern    = regexp.MustCompile(`(?i)\b(?:(?:on |by |this |next |on next |by next )(` + weekdayNames + `)|(` + fullWeekdayNames + `))\b`)
+	quickDatePattern       = regexp.MustCompile(`\b(?:on |by )?(\d{4}-\d{2}-\d{2})\b`)
+	quickOrdinalPattern    = regexp.MustCompile(`\d{1,2}`)
+	quickEdgePattern       = regexp.MustCompile(`(?i)^(?:to|and|then)\s+|[\s,:-]+$`)
+	quickTrailingPattern   = regexp.MustCompile(`(?i)\s+(?:to|on|by|for)$`)
+	quickWhitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// ParseQuickAdd splits free text such as a voice transcript into tasks, one per line
+// or sentence, and picks out due dates ("tomorrow", "on friday", "in 3 days"),
+// recurrences ("every monday", "daily"), #labels and a trailing "in the X project".
+// Dates are relative to now and have no time of day. Weekdays are only abbreviated
+// after "on", "by", "this" or "next".
+func ParseQuickAdd(text string, now time.Time) []QuickTask {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var tasks []QuickTask
+	for _, item := range quickSplitPattern.Split(text, -1) {
+		task := QuickTask{}
+		item = quickFillerPattern.ReplaceAllString(strings.TrimSpace(item), "")
+
+		for _, m := range quickLabelPattern.FindAllStringSubmatch(item, -1) {
+			task.Labels = append(task.Labels, m[1])
+		}
+		item = quickLabelPattern.ReplaceAllString(item, "")
+
+		if m := quickProjectPattern.FindStringSubmatch(item); m != nil {
+			task.Project = strings.TrimSpace(m[1] + m[2])
+			item = strings.Replace(item, m[0], "", 1)
+		}
+
+		dated := false
+		if m := quickEveryPattern.FindStringSubmatch(item); m != nil {
+			task.Recurrence, task.DueDate = quickRecurrence(strings.ToLower(m[1]+m[2]), today)
+			item = strings.Replace(item, m[0], "", 1)
+			dated = true
+		}
+
+		if due, rest, ok := quickDueDate(item, today); ok {
+			task.DueDate = &due
+			item = rest
+			dated = true
+		}
+
+		item = quickWhitespacePattern.ReplaceAllString(item, " ")
+		item = strings.TrimSpace(quickEdgePattern.ReplaceAllString(strings.TrimSpace(item), ""))
+		if dated {
+			// "Move errands to saturday" leaves the preposition behind
+			item = quickTrailingPattern.ReplaceAllString(item, "")
+		}
+		if item == "" {
+			continue
+		}
+		first, size := utf8.DecodeRuneInString(item)
+		task.Description = string(unicode.ToUpper(first)) + item[size:]
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// quickRecurrence turns the words after "every" into a recurrence pattern and the date
+// of its first occurrence
+func quickRecurrence(phrase string, today time.Time) (string, *time.Time) {
+	switch {
+	case phrase == "day" || phrase == "daily":
+		return "daily", &today
+	case phrase == "week" || phrase == "weekly":
+		return "weekly", &today
+	case phrase == "weekday":
+		phrase = "mon,tue,wed,thu,fri"
+	case strings.Contains(phrase, "month"):
+		day, _ := strconv.Atoi(quickOrdinalPattern.FindString(phrase))
+		if day < 1 || day > 31 {
+			return "", nil
+		}
+		next := findNextMonthlyDate(today.AddDate(0, 0, -1), day, 0)
+		return strconv.Itoa(day), &next
+	default:
+		var days []string
+		for _, word := range strings.FieldsFunc(phrase, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if word != "and" && len(word) >= 3 && !slices.Contains(days, word[:3]) {
+				days = append(days, word[:3])
+			}
+		}
+		phrase = strings.Join(days, ",")
+	}
+
+	var weekdays []time.Weekday
+	for _, day := range strings.Split(phrase, ",") {
+		if wd, ok := recurrenceWeekdays[day]; ok {
+			weekdays = append(weekdays, wd)
+		}
+	}
+	if len(weekdays) == 0 {
+		return "", nil
+	}
+	// The first occurrence may be today
+	next := findNextWeekday(today.AddDate(0, 0, -1), weekdays)
+	return phrase, &next
+}
+
+// quickDueDate finds a due date in text, returning the text without it
+func quickDueDate(text string, today time.Time) (time.Time, string, bool) {
+	if m := quickDatePattern.FindStringSubmatch(text); m != nil {
+		if date, err := time.Parse(time.DateOnly, m[1]); err == nil {
+			return date, strings.Replace(text, m[0], "", 1), true
+		}
+	}
+
+	if m := quickTodayPattern.FindStringSubmatch(text); m != nil {
+		due := today
+		switch strings.ToLower(m[1]) {
+		case "tomorrow":
+			due = today.AddDate(0, 0, 1)
+		case "day after tomorrow":
+			due = today.AddDate(0, 0, 2)
+		}
+		return due, strings.Replace(text, m[0], "", 1), true
+	}
+
+	if m := quickInPattern.FindStringSubmatch(text); m != nil {
+		n, ok := numberWords[strings.ToLower(m[1])]
+		if !ok {
+			n, _ = strconv.Atoi(m[1])
+		}
+		due := today
+		switch strings.ToLower(m[2]) {
+		case "day":
+			due = today.AddDate(0, 0, n)
+		case "week":
+			due = today.AddDate(0, 0, 7*n)
+		case "month":
+			due = today.AddDate(0, n, 0)
+		}
+		return due, strings.Replace(text, m[0], "", 1), true
+	}
+
+	if m := quickWeekdayPattern.FindStringSubmatch(text); m != nil {
+		name := strings.ToLower(m[1] + m[2])
+		if wd, ok := recurrenceWeekdays[name[:3]]; ok {
+			// A bare weekday is its next occurrence, never today
+			due := findNextWeekday(today, []time.Weekday{wd})
+			return due, strings.Replace(text, m[0], "", 1), true
+		}
+	}
+
+	return time.Time{}, text, false
+}
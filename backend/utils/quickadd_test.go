@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// quickTaskString describes a task as description|due|recurrence|project|labels
+func quickTaskString(task QuickTask) string {
+	due := ""
+	if task.DueDate != nil {
+		due = task.DueDate.Format(time.DateOnly)
+	}
+	return fmt.Sprintf("%s|%s|%s|%s|%s", task.Description, due, task.Recurrence, task.Project, strings.Join(task.Labels, ","))
+}
+
+func TestParseQuickAdd(t *testing.T) {
+	// A Wednesday afternoon
+	now := time.Date(2026, 10, 14, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"Buy milk", []string{"Buy milk||||"}},
+		{"remind me to buy milk tomorrow #shopping", []string{"Buy milk|2026-10-15|||shopping"}},
+		{"Call mom today", []string{"Call mom|2026-10-14|||"}},
+		{"Pay the bill day after tomorrow", []string{"Pay the bill|2026-10-16|||"}},
+		{"Submit report in 3 days in the Work project", []string{"Submit report|2026-10-17||Work|"}},
+		{"Renew passport in two weeks", []string{"Renew passport|2026-10-28|||"}},
+		{"Book flights on 2026-12-01", []string{"Book flights|2026-12-01|||"}},
+		{"Finish slides by friday", []string{"Finish slides|2026-10-16|||"}},
+		// A bare weekday is never today
+		{"Plan the week Wednesday", []string{"Plan the week|2026-10-21|||"}},
+		{"Call the plumber on mon", []string{"Call the plumber|2026-10-19|||"}},
+		{"Move all errands to Saturday", []string{"Move all errands|2026-10-17|||"}},
+		{"Pick up the cake for Friday", []string{"Pick up the cake|2026-10-16|||"}},
+		// Abbreviations without on/by/this/next aren't dates
+		{"Check the Mon Repos hotel", []string{"Check the Mon Repos hotel||||"}},
+		{"Sat down with the team", []string{"Sat down with the team||||"}},
+		// Prepositions only go when a date was taken out
+		{"Sign up for", []string{"Sign up for||||"}},
+		{"Water plants every monday and thursday", []string{"Water plants|2026-10-15|mon,thu||"}},
+		{"Stand-up every weekday", []string{"Stand-up|2026-10-14|mon,tue,wed,thu,fri||"}},
+		{"Pay rent every 1st of the month", []string{"Pay rent|2026-11-01|1||"}},
+		{"Take vitamins daily", []string{"Take vitamins|2026-10-14|daily||"}},
+		{"Add task review PRs to the project Side Hustle", []string{"Review PRs|||Side Hustle|"}},
+		{
+			"Call the bank. Then email Anna; water plants daily and then stretch",
+			[]string{"Call the bank||||", "Email Anna||||", "Water plants|2026-10-14|daily||", "Stretch||||"},
+		},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, task := range ParseQuickAdd(test.text, now) {
+			got = append(got, quickTaskString(task))
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("ParseQuickAdd(%q):\ngot  %q\nwant %q", test.text, got, test.want)
+		}
+	}
+}
@@ -8,6 +8,22 @@ import (
 	"time"
 )
 
+var dailyPatterns = []string{"day", "daily", "everyday", "every day"}
+
+var weeklyPatterns = []string{"week", "weekly", "every week"}
+
+var recurrenceWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
+	"wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+var recurrenceMonths = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March,
+	"apr": time.April, "may": time.May, "jun": time.June,
+	"jul": time.July, "aug": time.August, "sep": time.September,
+	"oct": time.October, "nov": time.November, "dec": time.December,
+}
+
 // ValidateRecurrence validates the recurrence string by trying to calculate next due date
 func ValidateRecurrence(recurrence string) error {
 	if recurrence == "" {
@@ -46,38 +62,31 @@ func CalculateNextDueDate(recurrence string, currentDue *time.Time) (*time.Time,
 	}
 
 	// Daily
-	dailyPatterns := []string{"day", "daily", "everyday", "every day"}
 	if slices.Contains(dailyPatterns, strings.ToLower(recurrence)) {
 		next := baseDate.AddDate(0, 0, 1)
 		return &next, nil
 	}
 
 	// Weekly (same day next week)
-	weeklyPatterns := []string{"week", "weekly", "every week"}
 	if slices.Contains(weeklyPatterns, strings.ToLower(recurrence)) {
 		next := baseDate.AddDate(0, 0, 7)
 		return &next, nil
 	}
 
 	// Weekly patterns (specific weekdays)
-	weekdays := map[string]time.Weekday{
-		"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
-		"wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
-	}
-
 	if strings.Contains(recurrence, ",") {
 		// Multiple weekdays - find next occurrence
 		days := strings.Split(recurrence, ",")
 		var targetWeekdays []time.Weekday
 		for _, day := range days {
-			if wd, ok := weekdays[strings.TrimSpace(strings.ToLower(day))[:3]]; ok {
+			if wd, ok := recurrenceWeekdays[strings.TrimSpace(strings.ToLower(day))[:3]]; ok {
 				targetWeekdays = append(targetWeekdays, wd)
 			}
 		}
 
 		next := findNextWeekday(baseDate, targetWeekdays)
 		return &next, nil
-	} else if wd, ok := weekdays[strings.ToLower(recurrence)]; ok {
+	} else if wd, ok := recurrenceWeekdays[strings.ToLower(recurrence)]; ok {
 		// Single weekday
 		next := findNextWeekday(baseDate, []time.Weekday{wd})
 		return &next, nil
@@ -96,13 +105,7 @@ func CalculateNextDueDate(recurrence string, currentDue *time.Time) (*time.Time,
 		// Yearly on specific day and month
 		day, err := strconv.Atoi(parts[0])
 		if err == nil {
-			monthMap := map[string]time.Month{
-				"jan": time.January, "feb": time.February, "mar": time.March,
-				"apr": time.April, "may": time.May, "jun": time.June,
-				"jul": time.July, "aug": time.August, "sep": time.September,
-				"oct": time.October, "nov": time.November, "dec": time.December,
-			}
-			if month, ok := monthMap[strings.ToLower(parts[1])[:3]]; ok {
+			if month, ok := recurrenceMonths[strings.ToLower(parts[1])[:3]]; ok {
 				next := findNextYearlyDate(baseDate, day, month)
 				return &next, nil
 			}
@@ -112,6 +115,68 @@ func CalculateNextDueDate(recurrence string, currentDue *time.Time) (*time.Time,
 	return nil, fmt.Errorf("unsupported recurrence pattern: %s", recurrence)
 }
 
+// NextOccurrenceAfter advances a recurring due date until it falls after the given time.
+// Returns nil if the recurrence can't be calculated.
+func NextOccurrenceAfter(recurrence string, due time.Time, after time.Time) *time.Time {
+	next := &due
+	// Bound the loop so a malformed pattern can't spin forever
+	for range 10000 {
+		if next.After(after) {
+			return next
+		}
+		var err error
+		next, err = CalculateNextDueDate(recurrence, next)
+		if err != nil || next == nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// IsScheduledOn reports whether a recurrence has an occurrence on the given day.
+// Plain weekly recurrences repeat on the weekday of anchor, normally the task's due date.
+func IsScheduledOn(recurrence string, anchor, day time.Time) (bool, error) {
+	pattern := strings.ToLower(strings.TrimSpace(recurrence))
+
+	if slices.Contains(dailyPatterns, pattern) {
+		return true, nil
+	}
+
+	if slices.Contains(weeklyPatterns, pattern) {
+		return day.Weekday() == anchor.Weekday(), nil
+	}
+
+	if strings.Contains(pattern, ",") {
+		for _, d := range strings.Split(pattern, ",") {
+			d = strings.TrimSpace(d)
+			if len(d) < 3 {
+				continue
+			}
+			if wd, ok := recurrenceWeekdays[d[:3]]; ok && wd == day.Weekday() {
+				return true, nil
+			}
+		}
+		return false, nil
+	} else if wd, ok := recurrenceWeekdays[pattern]; ok {
+		return day.Weekday() == wd, nil
+	}
+
+	parts := strings.Fields(pattern)
+	if len(parts) == 1 {
+		if d, err := strconv.Atoi(parts[0]); err == nil && d >= 1 && d <= 31 {
+			return day.Day() == d, nil
+		}
+	} else if len(parts) == 2 && len(parts[1]) >= 3 {
+		if d, err := strconv.Atoi(parts[0]); err == nil {
+			if month, ok := recurrenceMonths[parts[1][:3]]; ok {
+				return day.Day() == d && day.Month() == month, nil
+			}
+		}
+	}
+
+	return false, fmt.Errorf("unsupported recurrence pattern: %s", recurrence)
+}
+
 func findNextWeekday(from time.Time, weekdays []time.Weekday) time.Time {
 	for i := 1; i <= 7; i++ {
 		candidate := from.AddDate(0, 0, i)
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dima-b/go-task-backend/ai"
+	"github.com/dima-b/go-task-backend/database"
+	"github.com/dima-b/go-task-backend/logger"
+	"github.com/dima-b/go-task-backend/utils"
+)
+
+// Recordings become a note by default, or tasks with ?mode=tasks
+const (
+	audioModeNote  = "note"
+	audioModeTasks = "tasks"
+)
+
+// Tasks are read from a transcript by the agent, or by the quick-add parser when the
+// agent isn't configured or ?parser=quick asks for it
+const (
+	voiceParserAgent = "agent"
+	voiceParserQuick = "quick"
+)
+
+const voiceTasksPrompt = `The user recorded a voice memo. Create a task with create_task for every action
+item in it, with the due date, recurrence and project when they are mentioned. Don't create
+anything else. When you are done, answer with a short summary of the tasks.`
+
+type VoiceTasksResponse struct {
+	AudioID    uint            `json:"audio_id"`
+	Transcript string          `json:"transcript"`
+	Parser     string          `json:"parser"`
+	Tasks      []database.Task `json:"tasks"`
+	Actions    []AIAction      `json:"actions,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+func validateAudioMode(mode, parser string) error {
+	if mode != "" && mode != audioModeNote && mode != audioModeTasks {
+		return fmt.Errorf("mode must be %s or %s", audioModeNote, audioModeTasks)
+	}
+	if parser != "" && parser != voiceParserAgent && parser != voiceParserQuick {
+		return fmt.Errorf("parser must be %s or %s", voiceParserAgent, voiceParserQuick)
+	}
+	if parser == voiceParserAgent && aiProvider == nil {
+		return fmt.Errorf("AI commands are not configured")
+	}
+	return nil
+}
+
+// createVoiceTasks turns a transcript into tasks linked to the recording
+func createVoiceTasks(w http.ResponseWriter, r *http.Request, audio database.Audio, transcript, parser string) {
+	if parser == "" {
+		parser = voiceParserQuick
+		if aiProvider != nil {
+			parser = voiceParserAgent
+		}
+	}
+	logger.Info("Creating tasks from transcript").Uint("audio_id", audio.ID).Str("parser", parser).Send()
+
+	response := VoiceTasksResponse{AudioID: audio.ID, Transcript: transcript, Parser: parser}
+	var err error
+	if parser == voiceParserAgent {
+		response.Tasks, response.Actions, err = agentVoiceTasks(r, audio.ID, transcript)
+	} else {
+		response.Tasks, err = quickVoiceTasks(r, audio.ID, transcript)
+	}
+	if response.Tasks == nil {
+		response.Tasks = []database.Task{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		logger.Error("Failed to create tasks from transcript").Uint("audio_id", audio.ID).Int("created", len(response.Tasks)).Err(err).Send()
+		response.Error = err.Error()
+		if parser == voiceParserAgent {
+			w.WriteHeader(agentErrorStatus(err))
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	logger.Info("Successfully created tasks from transcript").Uint("audio_id", audio.ID).Int("count", len(response.Tasks)).Send()
+	json.NewEncoder(w).Encode(response)
+}
+
+// agentVoiceTasks lets the agent create the tasks, with create_task as its only tool
+func agentVoiceTasks(r *http.Request, audioID uint, transcript string) ([]database.Task, []AIAction, error) {
+	agentContext, err := commandContext()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session := &commandSession{r: r, audioID: &audioID}
+	var tools []ai.Tool
+	for _, tool := range session.tools() {
+		if tool.Name == "create_task" {
+			tools = append(tools, tool)
+		}
+	}
+
+	agent := newCommandAgent(agentContext, voiceTasksPrompt, tools)
+	ctx, cancel := commandDeadline(r)
+	defer cancel()
+	_, err = agent.Execute(ctx, transcript)
+	return session.created, session.actions, err
+}
+
+// quickVoiceTasks creates a task for every item the quick-add parser finds. Unknown
+// projects fall back to the Inbox and unusable recurrences are dropped, so no item
+// of the recording is lost.
+func quickVoiceTasks(r *http.Request, audioID uint, transcript string) ([]database.Task, error) {
+	var tasks []database.Task
+	for _, item := range utils.ParseQuickAdd(transcript, time.Now()) {
+		t := database.Task{
+			Description: item.Description,
+			DueDate:     item.DueDate,
+			Recurrence:  item.Recurrence,
+			Labels:      item.Labels,
+			AudioID:     &audioID,
+		}
+		if item.Project != "" {
+			project, err := findProject(database.DB, item.Project)
+			if err == nil && project.ArchivedAt == nil {
+				t.ProjectID = &project.ID
+			} else {
+				logger.Warn("Using Inbox for spoken project").Str("project", item.Project).Err(err).Send()
+			}
+		}
+
+		err := saveNewTask(database.DB, &t)
+		var invalid invalidTaskError
+		if errors.As(err, &invalid) {
+			logger.Warn("Dropping spoken recurrence").Str("recurrence", t.Recurrence).Err(err).Send()
+			t.Recurrence = ""
+			err = saveNewTask(database.DB, &t)
+		}
+		if err != nil {
+			return tasks, err
+		}
+
+		recordActivity(r, database.ActivityEntityTask, t.ID, database.ActivityCreate, nil, t)
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}